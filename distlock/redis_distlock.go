@@ -1,13 +1,19 @@
 package distlock
 
 import (
+	"context"
+
 	"github.com/gomodule/redigo/redis"
 	"github.com/im7mortal/kmutex"
+	"github.com/kitabisa/perkakas/v2/tracing"
 )
 
 type DistLock struct {
 	Pool   *redis.Pool
 	Kmutex *kmutex.Kmutex
+
+	// Tracer trace the calls with context. Nil tracer uses the tracer of the span in the context or the global tracer.
+	Tracer *tracing.Tracer
 }
 
 func New(pool *redis.Pool) (distLock *DistLock) {
@@ -20,17 +26,39 @@ func New(pool *redis.Pool) (distLock *DistLock) {
 }
 
 func (d *DistLock) SetCacheWithDistLock(key string, ttl interface{}, value interface{}) (err error) {
+	return d.SetCacheWithDistLockContext(context.Background(), key, ttl, value)
+}
+
+// SetCacheWithDistLockContext is like SetCacheWithDistLock, traced as the child of the span in ctx
+func (d *DistLock) SetCacheWithDistLockContext(ctx context.Context, key string, ttl interface{}, value interface{}) (err error) {
+	_, span := d.Tracer.Start(ctx, "distlock.SetCacheWithDistLock", tracing.WithAttributes(map[string]interface{}{
+		"db.system":    "redis",
+		"distlock.key": key,
+	}))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
 	d.Kmutex.Lock(key)
 	defer d.Kmutex.Unlock(key)
 
-	_, err = redis.Bytes(d.Pool.Get().Do("GET", key))
+	conn := d.Pool.Get()
+	defer conn.Close()
+
+	_, err = redis.Bytes(conn.Do("GET", key))
 	if err == redis.ErrNil {
-		_, err := d.Pool.Get().Do("SETEX", key, ttl, value)
+		span.SetAttribute("distlock.cache_hit", false)
+		_, err := conn.Do("SETEX", key, ttl, value)
 		if err != nil {
 			return err
 		}
+
+		return nil
 	}
 
+	// the error other than cache miss is ignored as before, but still recorded to the span
+	span.RecordError(err)
+	span.SetAttribute("distlock.cache_hit", err == nil)
 	return nil
 }
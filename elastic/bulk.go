@@ -0,0 +1,364 @@
+package elastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	es "github.com/olivere/elastic/v7"
+
+	"github.com/kitabisa/perkakas/v2/metrics/influx"
+)
+
+const (
+	defaultBulkMaxRetries         = 3
+	defaultBulkRetryInitialPeriod = 100 * time.Millisecond
+	defaultBulkRetryMaxPeriod     = 8 * time.Second
+)
+
+// bulkRetryStatusCodes is the status of the documents retried by the bulk processor
+var bulkRetryStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusInsufficientStorage: true,
+}
+
+// BulkFailure is a document failed to be indexed by the bulk processor
+type BulkFailure struct {
+	Processor string          `json:"processor"`
+	Index     string          `json:"index"`
+	ID        string          `json:"id,omitempty"`
+	Status    int             `json:"status"`
+	Error     string          `json:"error"`
+	Document  json.RawMessage `json:"document,omitempty"`
+
+	// Request is the failed bulk request, e.g. to add it to the bulk processor again
+	Request es.BulkableRequest `json:"-"`
+}
+
+// DeadLetterSink receives the documents failed to be indexed, e.g. to be reindexed later
+type DeadLetterSink interface {
+	WriteFailures(failures []BulkFailure) error
+}
+
+// DeadLetterFunc is an adapter to use function as DeadLetterSink
+type DeadLetterFunc func(failures []BulkFailure) error
+
+// WriteFailures calls f(failures)
+func (f DeadLetterFunc) WriteFailures(failures []BulkFailure) error {
+	return f(failures)
+}
+
+type writerDeadLetter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterDeadLetter create dead letter sink writing the failures to w as json, one failure per line
+func NewWriterDeadLetter(w io.Writer) DeadLetterSink {
+	return &writerDeadLetter{w: w}
+}
+
+func (d *writerDeadLetter) WriteFailures(failures []BulkFailure) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	encoder := json.NewEncoder(d.w)
+	for _, failure := range failures {
+		if err = encoder.Encode(failure); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// BulkStats is the statistics of a bulk processor since it's created
+type BulkStats struct {
+	Flushed      int64 // number of bulk requests committed
+	Indexed      int64 // number of documents indexed
+	Failed       int64 // number of documents failed, after the retries
+	Retried      int64 // number of documents retried, e.g. after rejected with 429 Too Many Requests
+	DeadLettered int64 // number of documents written to the dead letter sink
+}
+
+func (s *BulkStats) snapshot() BulkStats {
+	return BulkStats{
+		Flushed:      atomic.LoadInt64(&s.Flushed),
+		Indexed:      atomic.LoadInt64(&s.Indexed),
+		Failed:       atomic.LoadInt64(&s.Failed),
+		Retried:      atomic.LoadInt64(&s.Retried),
+		DeadLettered: atomic.LoadInt64(&s.DeadLettered),
+	}
+}
+
+// BulkStats returns the statistics of the bulk processor
+func (c *Client) BulkStats(name string) (stats BulkStats, err error) {
+	if name == "" {
+		name = "default"
+	}
+
+	c.mu.RLock()
+	s, ok := c.bulkStats[name]
+	c.mu.RUnlock()
+
+	if !ok {
+		err = fmt.Errorf("Bulk processor with name %s not found", name)
+		return
+	}
+
+	return s.snapshot(), nil
+}
+
+// ExportBulkStats write the statistics of all bulk processors to influx as the measurement, one point per processor
+// tagged with the processor name. Call it periodically, the counts are cumulative.
+func (c *Client) ExportBulkStats(influxClient *influx.Client, measurement string) (err error) {
+	writer, err := influxClient.NewBatchPointsWriter("s")
+	if err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, s := range c.bulkStats {
+		stats := s.snapshot()
+		writer.AddPoints(measurement, influx.Tags{"processor": name}, influx.Fields{
+			"flushed":       stats.Flushed,
+			"indexed":       stats.Indexed,
+			"failed":        stats.Failed,
+			"retried":       stats.Retried,
+			"dead_lettered": stats.DeadLettered,
+		})
+	}
+
+	return writer.Write()
+}
+
+// bulkReporter retry the rejected documents, then report the per item result of each bulk request
+type bulkReporter struct {
+	client    *Client
+	processor BulkProcessor
+	stats     *BulkStats
+}
+
+func newBulkReporter(c *Client, processor BulkProcessor) *bulkReporter {
+	if processor.MaxRetries == 0 {
+		processor.MaxRetries = defaultBulkMaxRetries
+	}
+
+	if processor.RetryBackoff == nil {
+		processor.RetryBackoff = es.NewExponentialBackoff(defaultBulkRetryInitialPeriod, defaultBulkRetryMaxPeriod)
+	}
+
+	return &bulkReporter{
+		client:    c,
+		processor: processor,
+		stats:     &BulkStats{},
+	}
+}
+
+// after is called by the bulk processor worker after each commit. Retrying the rejected documents blocks the worker,
+// so the bulk processor slows down while elasticsearch is overloaded.
+func (r *bulkReporter) after(executionID int64, requests []es.BulkableRequest, response *es.BulkResponse, err error) {
+	atomic.AddInt64(&r.stats.Flushed, 1)
+
+	var failures []BulkFailure
+	if err != nil {
+		for _, req := range requests {
+			failures = append(failures, newBulkFailure(r.processor.Name, req, nil, err))
+		}
+	} else if response != nil {
+		response = r.retryRejected(requests, response)
+
+		for i, item := range response.Items {
+			for op, result := range item {
+				if isBulkItemSucceeded(op, result) {
+					atomic.AddInt64(&r.stats.Indexed, 1)
+					continue
+				}
+
+				var req es.BulkableRequest
+				if i < len(requests) {
+					req = requests[i]
+				}
+
+				failures = append(failures, newBulkFailure(r.processor.Name, req, result, nil))
+			}
+		}
+	}
+
+	r.report(failures)
+
+	if r.processor.After != nil {
+		r.processor.After(executionID, requests, response, err)
+	}
+}
+
+// retryRejected retry the documents rejected with 429 Too Many Requests or temporarily unavailable with backoff, and returns copy of response
+// with the result of the last retry of each document, so the items are still in the same order as the requests
+func (r *bulkReporter) retryRejected(requests []es.BulkableRequest, response *es.BulkResponse) *es.BulkResponse {
+	if r.processor.MaxRetries < 0 || !response.Errors {
+		return response
+	}
+
+	merged := *response
+	merged.Items = append([]map[string]*es.BulkResponseItem(nil), response.Items...)
+
+	for retry := 1; retry <= r.processor.MaxRetries; retry++ {
+		// positions of the rejected documents in requests
+		var positions []int
+		for i, item := range merged.Items {
+			if i < len(requests) && isBulkItemRejected(item) {
+				positions = append(positions, i)
+			}
+		}
+
+		if len(positions) == 0 {
+			break
+		}
+
+		wait, ok := r.processor.RetryBackoff.Next(retry)
+		if !ok || !r.wait(wait) {
+			break
+		}
+
+		atomic.AddInt64(&r.stats.Retried, int64(len(positions)))
+
+		bulk := r.client.esclient.Bulk()
+		for _, i := range positions {
+			bulk = bulk.Add(requests[i])
+		}
+
+		res, err := bulk.Do(r.client.ctx)
+		if err != nil || len(res.Items) != len(positions) {
+			onError(fmt.Errorf("elastic: bulk processor %s failed to retry: %v", r.processor.Name, err))
+			break
+		}
+
+		for j, i := range positions {
+			merged.Items[i] = res.Items[j]
+		}
+	}
+
+	merged.Errors = false
+	for _, item := range merged.Items {
+		for op, result := range item {
+			if !isBulkItemSucceeded(op, result) {
+				merged.Errors = true
+			}
+		}
+	}
+
+	return &merged
+}
+
+// wait wait for the retry backoff. It returns false when the client is closed.
+func (r *bulkReporter) wait(wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.client.ctx.Done():
+		return false
+	}
+}
+
+func (r *bulkReporter) report(failures []BulkFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	atomic.AddInt64(&r.stats.Failed, int64(len(failures)))
+
+	if r.processor.OnFailure != nil {
+		for _, failure := range failures {
+			r.processor.OnFailure(failure)
+		}
+	}
+
+	if r.processor.DeadLetter != nil {
+		if err := r.processor.DeadLetter.WriteFailures(failures); err != nil {
+			onError(fmt.Errorf("elastic: bulk processor %s failed to write dead letter: %v", r.processor.Name, err))
+			return
+		}
+
+		atomic.AddInt64(&r.stats.DeadLettered, int64(len(failures)))
+	}
+}
+
+func newBulkFailure(processorName string, req es.BulkableRequest, result *es.BulkResponseItem, err error) (failure BulkFailure) {
+	failure.Processor = processorName
+	failure.Request = req
+
+	if req != nil {
+		if lines, sourceErr := req.Source(); sourceErr == nil && len(lines) > 0 {
+			// the first line is the action and metadata, e.g. {"index":{"_index":"donation","_id":"1"}}
+			var action map[string]struct {
+				Index string `json:"_index"`
+				ID    string `json:"_id"`
+			}
+
+			if json.Unmarshal([]byte(lines[0]), &action) == nil {
+				for _, meta := range action {
+					failure.Index, failure.ID = meta.Index, meta.ID
+				}
+			}
+
+			if len(lines) > 1 {
+				failure.Document = json.RawMessage(lines[1])
+			}
+		}
+	}
+
+	if result != nil {
+		failure.Status = result.Status
+		if result.Index != "" {
+			failure.Index = result.Index
+		}
+
+		if result.Id != "" {
+			failure.ID = result.Id
+		}
+
+		if result.Error != nil {
+			failure.Error = fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+		}
+	}
+
+	if err != nil {
+		failure.Error = err.Error()
+		if e, ok := err.(*es.Error); ok {
+			failure.Status = e.Status
+		}
+	}
+
+	return
+}
+
+// isBulkItemSucceeded check the result of the op, e.g. index or delete. Deleting the missing document is succeeded,
+// like es.BulkResponse.Failed does.
+func isBulkItemSucceeded(op string, result *es.BulkResponseItem) bool {
+	if op == "delete" && result.Status == http.StatusNotFound {
+		return true
+	}
+
+	return result.Status >= 200 && result.Status <= 299
+}
+
+func isBulkItemRejected(item map[string]*es.BulkResponseItem) bool {
+	for _, result := range item {
+		if bulkRetryStatusCodes[result.Status] {
+			return true
+		}
+	}
+
+	return false
+}
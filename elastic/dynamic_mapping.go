@@ -5,6 +5,14 @@ type DynamicTemplate struct {
 	Mappings *Mappings                   `json:"mappings,omitempty"`
 }
 
+// IndexTemplate is applied to the new index matching IndexPatterns, e.g. daily index
+type IndexTemplate struct {
+	IndexPatterns []string               `json:"index_patterns"`
+	Order         int                    `json:"order,omitempty"`
+	Settings      map[string]interface{} `json:"settings,omitempty"`
+	Mappings      *Mappings              `json:"mappings,omitempty"`
+}
+
 type Mappings struct {
 	DynamicTemplates []map[string]MatchConditions `json:"dynamic_templates"`
 	Properties       map[string]Property          `json:"properties"`
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/kitabisa/perkakas/v2/metrics/influx"
+	"github.com/kitabisa/perkakas/v2/tracing"
 	es "github.com/olivere/elastic/v7"
+	"net/http"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -20,15 +24,32 @@ type ElasticClient interface {
 
 type ElasticBasicActions interface{
 	Search(ctx context.Context, indexName string, option SearchOption) (result []byte, err error)
+	SearchHits(ctx context.Context, indexName string, option SearchOption) (result *SearchResult, err error)
+	SearchInto(ctx context.Context, indexName string, option SearchOption, out interface{}) (result *SearchResult, err error)
+	Scan(ctx context.Context, indexName string, query es.Query, options ...ScanOption) Iterator
+	ScanSlices(ctx context.Context, indexName string, query es.Query, slices int, options ...ScanOption) []Iterator
 	Store(ctx context.Context, name string, doc interface{}, template *DynamicTemplate) (res *es.IndexResponse, err error)
+	Update(ctx context.Context, indexName string, id string, doc interface{}) (res *es.UpdateResponse, err error)
+	Upsert(ctx context.Context, indexName string, id string, script Script, upsert interface{}) (res *es.UpdateResponse, err error)
+	UpdateByQuery(ctx context.Context, indexName string, option ByQueryOption) (res *es.BulkIndexByScrollResponse, err error)
+	Get(ctx context.Context, indexName string, id string, out interface{}) (found bool, err error)
+	MultiGet(ctx context.Context, indexName string, ids []string, out interface{}) (foundIDs []string, err error)
 	Remove(ctx context.Context, indexName string, id string) (res *es.DeleteResponse, err error)
+	DeleteByQuery(ctx context.Context, indexName string, option ByQueryOption) (res *es.BulkIndexByScrollResponse, err error)
 	RemoveIndex(ctx context.Context, indexName ...string) (res *es.IndicesDeleteResponse, err error)
 	Ping(ctx context.Context, nodeURL string) (*es.PingResult, int, error)
+	PutIndexTemplate(ctx context.Context, name string, template *IndexTemplate) (res *es.IndicesPutTemplateResponse, err error)
 }
 
 type ElasticBulkActions interface {
 	AddBulkProcessor(bulkProcessor BulkProcessor) (err error)
 	BulkStore(ctx context.Context, indexName string, processorName string, docs []interface{}, template *DynamicTemplate) (err error)
+	BulkUpdate(ctx context.Context, indexName string, processorName string, docs []interface{}) (err error)
+	BulkRemove(ctx context.Context, indexName string, processorName string, ids []string) (err error)
+	GetBulkProcessor(name string) (processor *es.BulkProcessor, err error)
+	BulkStats(name string) (stats BulkStats, err error)
+	ExportBulkStats(influxClient *influx.Client, measurement string) (err error)
+	Close() (err error)
 }
 
 type BulkProcessor struct {
@@ -37,11 +58,38 @@ type BulkProcessor struct {
 	BulkActions int
 	BulkSize int
 	FlushInterval time.Duration
+
+	// Before is called before each bulk request is committed
+	Before es.BulkBeforeFunc
+
+	// After is called after each bulk request is committed, with the error or the per item response.
+	// The response has the result of the last retry of the rejected documents.
+	After es.BulkAfterFunc
+
+	// OnFailure is called for each document failed to be indexed, after the retries
+	OnFailure func(failure BulkFailure)
+
+	// DeadLetter receives the documents failed to be indexed, see NewWriterDeadLetter
+	DeadLetter DeadLetterSink
+
+	// MaxRetries is the number of retries of the documents rejected with 429 Too Many Requests, or with 408, 503
+	// and 507 status, waiting for RetryBackoff between the retries. Default is 3 retries with exponential backoff from 100ms up to 8s.
+	// Negative MaxRetries disables the retry.
+	MaxRetries   int
+	RetryBackoff es.Backoff
 }
 
 type Client struct {
 	esclient *es.Client
 	Config ClientConfig
+	bulkStats map[string]*BulkStats
+
+	// mu guards Config.BulkProcessors and bulkStats
+	mu sync.RWMutex
+
+	// ctx is canceled by Close, to stop waiting for the retry of the rejected documents
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type ClientConfig struct {
@@ -52,16 +100,59 @@ type SearchOption struct {
 	Query es.Query
 	Sort map[string]bool
 	From int
-	Size int
+	Size int // default is 10, use negative size to return no hits, e.g. aggregations only
+
+	// Sorters sort by the fields in order, e.g. es.NewFieldSort("created_at").Desc(). Use it instead of Sort
+	// when the order matters, such as with SearchAfter.
+	Sorters []es.Sorter
+
+	// SourceIncludes and SourceExcludes filter the fields of the returned source
+	SourceIncludes []string
+	SourceExcludes []string
+
+	Highlight    *es.Highlight
+	Aggregations map[string]es.Aggregation
+
+	// SearchAfter is the sort values of the last hit of the previous page, see SearchResult.LastSort
+	SearchAfter []interface{}
+
+	// TrackTotalHits count the total hits accurately, instead of up to 10000
+	TrackTotalHits bool
 }
 
 func NewClient(urls ...string) (c ElasticClient, err error) {
-	esclient, err := es.NewClient(
+	return newClient(nil, urls...)
+}
+
+// NewClientWithTracer create client tracing every elastic search request with a client span, as the child of
+// the span in the request context. Nil tracer uses the global tracer.
+func NewClientWithTracer(tracer *tracing.Tracer, urls ...string) (c ElasticClient, err error) {
+	transport := &tracing.Transport{
+		Tracer: tracer,
+		SpanName: func(req *http.Request) string {
+			return fmt.Sprintf("elasticsearch %s %s", req.Method, req.URL.Path)
+		},
+		Attributes: map[string]interface{}{
+			"db.system": "elasticsearch",
+		},
+	}
+
+	return newClient(&http.Client{Transport: transport}, urls...)
+}
+
+func newClient(httpClient *http.Client, urls ...string) (c ElasticClient, err error) {
+	options := []es.ClientOptionFunc{
 		es.SetURL(urls...),
 		es.SetSniff(false),
 		es.SetHealthcheck(false),
 		es.SetRetrier(NewElasticRetrier(3 * time.Second, onError)),
-	)
+	}
+
+	if httpClient != nil {
+		options = append(options, es.SetHttpClient(httpClient))
+	}
+
+	esclient, err := es.NewClient(options...)
 	if err != nil {
 		return
 	}
@@ -69,40 +160,30 @@ func NewClient(urls ...string) (c ElasticClient, err error) {
 	client := &Client{
 		esclient: esclient,
 	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+
+	if err = client.defaultBulkProcessor(); err != nil {
+		return
+	}
 
-	client.defaultBulkProcessor()
 	c = client
 
 	return
 }
 
+// Search search the documents and returns the hit sources decoded into one json object, so it's only meaningful
+// for a single hit. Use SearchHits or SearchInto to get every hit, the total count and the aggregations.
 func (c *Client) Search(ctx context.Context, indexName string, option SearchOption) (result []byte, err error) {
-	if option.Size == 0 {
-		option.Size = 10 // default size to 10
-	}
-
-	search := c.esclient.Search().
-		Index(indexName).
-		Query(option.Query).
-		From(option.From).
-		Size(option.Size)
-
-	for k, v := range option.Sort {
-		search = search.Sort(k, v)
-	}
-
-	searchResult, err := search.Do(ctx)
+	searchResult, err := c.SearchHits(ctx, indexName, option)
 	if err != nil {
 		return
 	}
 
 	var source map[string]interface{}
-	if searchResult.Hits.TotalHits.Value > 0 {
-		for _, hit := range searchResult.Hits.Hits {
-			err = json.Unmarshal(hit.Source, &source)
-			if err != nil {
-				return
-			}
+	for _, hit := range searchResult.Hits {
+		err = json.Unmarshal(hit.Source, &source)
+		if err != nil {
+			return
 		}
 	}
 
@@ -216,17 +297,38 @@ func (c *Client) BulkStore(ctx context.Context, indexName string, processorName
 }
 
 func (c *Client) newBulkProcessor(processor BulkProcessor) (bulkProcessor *es.BulkProcessor, err error){
-	bulkProcessor, err = c.esclient.BulkProcessor().
+	service := c.esclient.BulkProcessor().
 		Name(processor.Name).
 		Workers(processor.Workers).
 		BulkActions(processor.BulkActions).        // commit if # requests reach certain of number
 		BulkSize(processor.BulkSize).              // commit when document size reach certain size
-		FlushInterval(processor.FlushInterval).  // commit every interval of time
-		Do(context.Background())
+		FlushInterval(processor.FlushInterval)  // commit every interval of time
+
+	if processor.Before != nil {
+		service = service.Before(processor.Before)
+	}
+
+	// the rejected documents are retried by the reporter instead, so the after callback gets the result of all documents
+	reporter := newBulkReporter(c, processor)
+	service = service.After(reporter.after).RetryItemStatusCodes()
+
+	bulkProcessor, err = service.Do(context.Background())
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.bulkStats == nil {
+		c.bulkStats = make(map[string]*BulkStats)
+	}
+
+	c.bulkStats[processor.Name] = reporter.stats
 	return
 }
 
-func (c *Client) defaultBulkProcessor() {
+func (c *Client) defaultBulkProcessor() (err error) {
 	bulkProcessor := BulkProcessor{
 		Name:          "default",
 		Workers:       10,
@@ -235,12 +337,7 @@ func (c *Client) defaultBulkProcessor() {
 		FlushInterval: 1 * time.Second, // flush every 1 seconds
 	}
 
-	if c.Config.BulkProcessors == nil {
-		c.Config.BulkProcessors = make(map[string]*es.BulkProcessor)
-	}
-
-	defaultBulkProcessor, _ := c.newBulkProcessor(bulkProcessor)
-	c.Config.BulkProcessors[bulkProcessor.Name] = defaultBulkProcessor
+	return c.AddBulkProcessor(bulkProcessor)
 }
 
 func (c *Client) AddBulkProcessor(bulkProcessor BulkProcessor) (err error){
@@ -249,6 +346,13 @@ func (c *Client) AddBulkProcessor(bulkProcessor BulkProcessor) (err error){
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Config.BulkProcessors == nil {
+		c.Config.BulkProcessors = make(map[string]*es.BulkProcessor)
+	}
+
 	c.Config.BulkProcessors[bulkProcessor.Name] = processor
 	return
 }
@@ -258,6 +362,9 @@ func (c *Client) GetBulkProcessor(name string) (processor *es.BulkProcessor, err
 		name = "default"
 	}
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	processor, ok := c.Config.BulkProcessors[name]
 	if !ok {
 		err = fmt.Errorf("Bulk processor with name %s not found", name)
@@ -267,8 +374,34 @@ func (c *Client) GetBulkProcessor(name string) (processor *es.BulkProcessor, err
 	return
 }
 
+// Close stop waiting for the retry of the rejected documents, then flush and close all bulk processors.
+// The documents still rejected are reported as failed, e.g. to the dead letter sink.
+func (c *Client) Close() (err error) {
+	c.cancel()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, processor := range c.Config.BulkProcessors {
+		if closeErr := processor.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("elastic: failed to close bulk processor %s: %w", name, closeErr)
+		}
+	}
+
+	return
+}
+
 func (c *Client) Ping(ctx context.Context, nodeURL string) (*es.PingResult, int, error){
 	return c.esclient.Ping(nodeURL).Do(ctx)
 }
 
+// PutIndexTemplate create or replace the index template, so the new index matching the template patterns gets its
+// settings and mappings
+func (c *Client) PutIndexTemplate(ctx context.Context, name string, template *IndexTemplate) (res *es.IndicesPutTemplateResponse, err error) {
+	res, err = c.esclient.IndexPutTemplate(name).
+		BodyJson(template).
+		Do(ctx)
+	return
+}
+
 
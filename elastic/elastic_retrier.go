@@ -25,6 +25,11 @@ func NewElasticRetrier(t time.Duration, f func(err error)) *ElasticRetrier {
 
 func (r *ElasticRetrier) Retry(ctx context.Context, retry int, req *http.Request, resp *http.Response, err error) (time.Duration, bool, error) {
 
+	// stop retrying when the caller gives up, e.g. the context deadline is exceeded
+	if ctx.Err() != nil {
+		return 0, false, ctx.Err()
+	}
+
 	log.Warn(errors.New(fmt.Sprintf("Elasticsearch Retrier #%d", retry)))
 
 	if err == syscall.ECONNREFUSED {
@@ -2,7 +2,12 @@ package elastic
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	es "github.com/olivere/elastic/v7"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -115,6 +120,234 @@ func TestClient_Search(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestClient_SearchHits(t *testing.T) {
+	var request map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"took": 3,
+			"hits": {
+				"total": {"value": 2, "relation": "eq"},
+				"max_score": null,
+				"hits": [
+					{"_index": "person", "_id": "1", "_source": {"id": "1", "name": "Alvin", "age": 17}, "highlight": {"name": ["<em>Alvin</em>"]}, "sort": [17, "1"]},
+					{"_index": "person", "_id": "2", "_source": {"id": "2", "name": "Mukidi", "age": 45}, "sort": [45, "2"]}
+				]
+			},
+			"aggregations": {"avg_age": {"value": 31}}
+		}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	option := SearchOption{
+		Query:          es.NewMatchQuery("name", "alvin"),
+		Sorters:        []es.Sorter{es.NewFieldSort("age"), es.NewFieldSort("id").Desc()},
+		SourceIncludes: []string{"id", "name", "age"},
+		Highlight:      es.NewHighlight().Field("name"),
+		Aggregations:   map[string]es.Aggregation{"avg_age": es.NewAvgAggregation().Field("age")},
+		SearchAfter:    []interface{}{10, "0"},
+	}
+
+	var persons []Person
+	result, err := c.SearchInto(ctx, "person", option, &persons)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(2), result.Total)
+	assert.Equal(t, int64(3), result.TookInMillis)
+	assert.Len(t, result.Hits, 2)
+	assert.Equal(t, "1", result.Hits[0].ID)
+	assert.Equal(t, []string{"<em>Alvin</em>"}, result.Hits[0].Highlight["name"])
+	assert.Equal(t, []interface{}{float64(45), "2"}, result.LastSort())
+	assert.Equal(t, []Person{{ID: "1", Name: "Alvin", Age: 17}, {ID: "2", Name: "Mukidi", Age: 45}}, persons)
+
+	var avg struct {
+		Value float64 `json:"value"`
+	}
+	found, err := result.AggregationInto("avg_age", &avg)
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(31), avg.Value)
+
+	assert.Equal(t, float64(10), request["size"])
+	assert.Equal(t, []interface{}{float64(10), "0"}, request["search_after"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"age": map[string]interface{}{"order": "asc"}},
+		map[string]interface{}{"id": map[string]interface{}{"order": "desc"}},
+	}, request["sort"])
+	assert.Contains(t, request, "highlight")
+	assert.Contains(t, request, "aggregations")
+	assert.Contains(t, request, "_source")
+
+	// Search keeps returning one json object for the existing callers
+	source, err := c.Search(ctx, "person", option)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"id":"2","name":"Mukidi","age":45}`, string(source))
+}
+
+// fakeScanServer serves 5 documents, 2 per page, like elasticsearch 7.minor: point in time since 7.10 and
+// _shard_doc sort since 7.12, otherwise scroll
+func fakeScanServer(minor int, cleanup *[]string) *httptest.Server {
+	page := func(from int) string {
+		var hits []string
+		for i := from; i < from+2 && i < 5; i++ {
+			hits = append(hits, fmt.Sprintf(`{"_id":"%d","_source":{"id":"%d"},"sort":[%d]}`, i, i, i))
+		}
+
+		return fmt.Sprintf(`{"pit_id":"pit-2","_scroll_id":"scroll-1","hits":{"total":{"value":5},"hits":[%s]}}`, strings.Join(hits, ","))
+	}
+
+	scrolled := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/person/_pit":
+			if minor < 10 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"no handler found for uri [/person/_pit] and method [POST]"}`))
+				return
+			}
+
+			w.Write([]byte(`{"id":"pit-1"}`))
+		case r.URL.Path == "/_search" && minor < 12 && strings.Contains(string(body), "_shard_doc"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"root_cause":[{"type":"query_shard_exception","reason":"No mapping found for [_shard_doc] in order to sort on"}],` +
+				`"type":"search_phase_execution_exception","reason":"all shards failed"},"status":400}`))
+		case r.URL.Path == "/_search":
+			var request struct {
+				SearchAfter []int `json:"search_after"`
+			}
+			json.Unmarshal(body, &request)
+
+			from := 0
+			if len(request.SearchAfter) > 0 {
+				from = request.SearchAfter[0] + 1
+			}
+
+			w.Write([]byte(page(from)))
+		case r.URL.Path == "/person/_search":
+			w.Write([]byte(page(0)))
+		case r.URL.Path == "/_search/scroll" && r.Method != http.MethodDelete:
+			scrolled += 2
+			w.Write([]byte(page(scrolled)))
+		default:
+			*cleanup = append(*cleanup, r.Method+" "+r.URL.Path+" "+string(body))
+			w.Write([]byte(`{}`))
+		}
+	}))
+}
+
+func TestClient_Scan(t *testing.T) {
+	for _, minor := range []int{12, 11, 9} {
+		var cleanup []string
+		ts := fakeScanServer(minor, &cleanup)
+
+		c, err := NewClient(ts.URL)
+		if err != nil {
+			t.FailNow()
+		}
+
+		it := c.Scan(context.Background(), "person", nil, WithBatchSize(2))
+
+		var ids []string
+		for it.Next() {
+			var person Person
+			assert.Nil(t, it.Decode(&person))
+			assert.Equal(t, it.Hit().ID, person.ID)
+			ids = append(ids, person.ID)
+		}
+
+		assert.Nil(t, it.Err(), minor)
+		assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids, minor)
+
+		// the context is released once the iteration is finished
+		assert.Nil(t, it.Close())
+		switch minor {
+		case 12:
+			assert.Equal(t, []string{`DELETE /_pit {"id":"pit-2"}`}, cleanup)
+		case 11:
+			// the point in time is released before falling back to scroll
+			assert.Equal(t, []string{`DELETE /_pit {"id":"pit-1"}`, `DELETE /_search/scroll {"scroll_id":["scroll-1"]}`}, cleanup)
+		default:
+			assert.Equal(t, []string{`DELETE /_search/scroll {"scroll_id":["scroll-1"]}`}, cleanup)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestClient_ScanPointInTimeError(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"type":"illegal_argument_exception","reason":"failed to parse [keep_alive]"},"status":400}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// the real error is returned instead of falling back to scroll
+	it := c.Scan(context.Background(), "person", nil, WithKeepAlive("forever"))
+	assert.False(t, it.Next())
+	assert.NotNil(t, it.Err())
+	assert.Contains(t, it.Err().Error(), "keep_alive")
+	assert.Equal(t, []string{"POST /person/_pit"}, requests)
+}
+
+func TestClient_ScanSlices(t *testing.T) {
+	var cleanup []string
+	fake := fakeScanServer(12, &cleanup)
+	defer fake.Close()
+
+	var opened int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/person/_pit" {
+			opened++
+		}
+
+		fake.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	iterators := c.ScanSlices(context.Background(), "person", es.NewMatchAllQuery(), 3, WithBatchSize(2))
+	assert.Len(t, iterators, 3)
+
+	// stop early, the point in time is still used by the other slices
+	assert.True(t, iterators[0].Next())
+	assert.Nil(t, iterators[0].Close())
+	assert.Empty(t, cleanup)
+
+	for _, it := range iterators[1:] {
+		for it.Next() {
+		}
+		assert.Nil(t, it.Err())
+	}
+
+	// the slices read the same point in time, released once after the last slice is finished
+	assert.Equal(t, 1, opened)
+	assert.Equal(t, []string{`DELETE /_pit {"id":"pit-1"}`}, cleanup)
+}
+
 func TestClient_Delete(t *testing.T) {
 	ctx := context.Background()
 	_, err := client.Remove(ctx, "campaign-coba-444", "1234")
@@ -162,6 +395,284 @@ func TestBulkStore(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestBulkProcessorFailures(t *testing.T) {
+	var bulks []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			// the index exists
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bulks = append(bulks, string(body))
+		w.Header().Set("Content-Type", "application/json")
+
+		if len(bulks) == 1 {
+			// index the first document, reject the second one with 429, and fail the third one
+			w.Write([]byte(`{"errors":true,"items":[
+				{"index":{"_index":"person","_id":"1","status":201}},
+				{"index":{"_index":"person","_id":"2","status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue is full"}}},
+				{"index":{"_index":"person","_id":"3","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}
+			]}`))
+			return
+		}
+
+		w.Write([]byte(`{"errors":false,"items":[{"index":{"_index":"person","_id":"2","status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	var before int
+	var after *es.BulkResponse
+	var failures []BulkFailure
+	deadLetter := new(strings.Builder)
+
+	err = c.AddBulkProcessor(BulkProcessor{
+		Name:          "person",
+		Workers:       1,
+		BulkActions:   100,
+		BulkSize:      2 << 20,
+		FlushInterval: time.Hour,
+		Before: func(executionID int64, requests []es.BulkableRequest) {
+			before += len(requests)
+		},
+		After: func(executionID int64, requests []es.BulkableRequest, response *es.BulkResponse, err error) {
+			after = response
+		},
+		OnFailure: func(failure BulkFailure) {
+			failures = append(failures, failure)
+		},
+		DeadLetter:   NewWriterDeadLetter(deadLetter),
+		RetryBackoff: es.NewConstantBackoff(time.Millisecond),
+	})
+	assert.Nil(t, err)
+
+	docs := []interface{}{
+		Person{ID: "1", Name: "Budi", Age: 17},
+		Person{ID: "2", Name: "Badu", Age: 50},
+		Person{ID: "3", Name: "Bedu", Age: 30},
+	}
+	err = c.BulkStore(context.Background(), "person", "person", docs, nil)
+	assert.Nil(t, err)
+
+	processor, err := c.GetBulkProcessor("person")
+	assert.Nil(t, err)
+	assert.Nil(t, processor.Flush())
+
+	// the rejected document is retried alone
+	assert.Len(t, bulks, 2)
+	assert.Contains(t, bulks[1], `"_id":"2"`)
+	assert.NotContains(t, bulks[1], `"_id":"3"`)
+
+	assert.Equal(t, 3, before)
+	assert.Len(t, after.Items, 3)
+	assert.Equal(t, 201, after.Items[1]["index"].Status)
+	assert.True(t, after.Errors)
+
+	assert.Len(t, failures, 1)
+	assert.Equal(t, "3", failures[0].ID)
+	assert.Equal(t, 400, failures[0].Status)
+	assert.Equal(t, "mapper_parsing_exception: failed to parse", failures[0].Error)
+	assert.JSONEq(t, `{"id":"3","name":"Bedu","age":30}`, string(failures[0].Document))
+
+	var deadLettered BulkFailure
+	assert.Nil(t, json.Unmarshal([]byte(deadLetter.String()), &deadLettered))
+	assert.Equal(t, "person", deadLettered.Processor)
+	assert.Equal(t, "3", deadLettered.ID)
+
+	stats, err := c.BulkStats("person")
+	assert.Nil(t, err)
+	assert.Equal(t, BulkStats{Flushed: 1, Indexed: 2, Failed: 1, Retried: 1, DeadLettered: 1}, stats)
+
+	_, err = c.BulkStats("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestClient_UpdateAndGet(t *testing.T) {
+	requests := make(map[string]string)
+	taskPolls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		// the default bulk processor has several workers, so the bulk requests are appended
+		requests[r.Method+" "+r.URL.Path] += string(body)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/person/_update/1", "/person/_update/2":
+			w.Write([]byte(`{"_index":"person","_id":"1","result":"updated"}`))
+		case "/person/_delete_by_query":
+			w.Write([]byte(`{"task":"node-1:42"}`))
+		case "/_tasks/node-1:42":
+			taskPolls++
+			if taskPolls == 1 {
+				w.Write([]byte(`{"completed":false}`))
+				return
+			}
+
+			w.Write([]byte(`{"completed":true,"response":{"total":2,"deleted":2}}`))
+		case "/person/_doc/1":
+			w.Write([]byte(`{"_index":"person","_id":"1","found":true,"_source":{"id":"1","name":"Budi","age":17}}`))
+		case "/person/_doc/404":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"_index":"person","_id":"404","found":false}`))
+		case "/_mget":
+			w.Write([]byte(`{"docs":[
+				{"_index":"person","_id":"1","found":true,"_source":{"id":"1","name":"Budi","age":17}},
+				{"_index":"person","_id":"404","found":false},
+				{"_index":"person","_id":"2","found":true,"_source":{"id":"2","name":"Badu","age":50}}
+			]}`))
+		case "/_bulk":
+			w.Write([]byte(`{"errors":false,"items":[{"update":{"status":200}},{"delete":{"status":200}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+
+	_, err = c.Update(ctx, "person", "1", map[string]interface{}{"age": 18})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"doc":{"age":18}}`, requests["POST /person/_update/1"])
+
+	_, err = c.Upsert(ctx, "person", "2", Script{
+		Source: "ctx._source.age += params.age",
+		Params: map[string]interface{}{"age": 1},
+	}, nil)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"script":{"source":"ctx._source.age += params.age","lang":"painless","params":{"age":1}},
+		"scripted_upsert":true,
+		"upsert":{}
+	}`, requests["POST /person/_update/2"])
+
+	res, err := c.DeleteByQuery(ctx, "person", ByQueryOption{
+		Query:        es.NewRangeQuery("age").Lt(17),
+		PollInterval: time.Millisecond,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res.Deleted)
+	assert.Equal(t, 2, taskPolls)
+
+	var person Person
+	found, err := c.Get(ctx, "person", "1", &person)
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, "Budi", person.Name)
+
+	found, err = c.Get(ctx, "person", "404", &person)
+	assert.False(t, found)
+	assert.Nil(t, err)
+
+	var persons []Person
+	ids, err := c.MultiGet(ctx, "person", []string{"1", "404", "2"}, &persons)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	assert.Equal(t, []Person{{ID: "1", Name: "Budi", Age: 17}, {ID: "2", Name: "Badu", Age: 50}}, persons)
+
+	err = c.BulkUpdate(ctx, "person", "", []interface{}{map[string]interface{}{"id": "1", "age": 19}})
+	assert.Nil(t, err)
+	err = c.BulkRemove(ctx, "person", "", []string{"2"})
+	assert.Nil(t, err)
+	err = c.BulkUpdate(ctx, "person", "", []interface{}{map[string]interface{}{"age": 19}})
+	assert.NotNil(t, err)
+
+	processor, err := c.GetBulkProcessor("")
+	assert.Nil(t, err)
+	assert.Nil(t, processor.Flush())
+
+	bulk := requests["POST /_bulk"]
+	assert.Contains(t, bulk, `{"update":{"_index":"person","_id":"1","retry_on_conflict":3}}`)
+	assert.Contains(t, bulk, `{"doc":{"age":19,"id":"1"}}`)
+	assert.Contains(t, bulk, `{"delete":{"_index":"person","_id":"2"}}`)
+}
+
+func TestBulkProcessorDeleteNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[{"delete":{"_index":"person","_id":"1","status":404,"result":"not_found"}}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	var failures []BulkFailure
+	err = c.AddBulkProcessor(BulkProcessor{
+		Name:          "person",
+		Workers:       1,
+		BulkActions:   100,
+		FlushInterval: time.Hour,
+		OnFailure: func(failure BulkFailure) {
+			failures = append(failures, failure)
+		},
+	})
+	assert.Nil(t, err)
+
+	// deleting the already deleted document is not a failure
+	assert.Nil(t, c.BulkRemove(context.Background(), "person", "person", []string{"1"}))
+	processor, err := c.GetBulkProcessor("person")
+	assert.Nil(t, err)
+	assert.Nil(t, processor.Flush())
+
+	assert.Empty(t, failures)
+	stats, err := c.BulkStats("person")
+	assert.Nil(t, err)
+	assert.Equal(t, BulkStats{Flushed: 1, Indexed: 1}, stats)
+}
+
+func TestBulkProcessorCloseCancelRetry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":true,"items":[{"index":{"_index":"person","_id":"1","status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue is full"}}}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	deadLetter := new(strings.Builder)
+	err = c.AddBulkProcessor(BulkProcessor{
+		Name:          "person",
+		Workers:       1,
+		BulkActions:   100,
+		FlushInterval: time.Hour,
+		DeadLetter:    NewWriterDeadLetter(deadLetter),
+		RetryBackoff:  es.NewConstantBackoff(time.Hour),
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.BulkStore(context.Background(), "person", "person", []interface{}{Person{ID: "1", Name: "Budi"}}, nil))
+
+	processor, err := c.GetBulkProcessor("person")
+	assert.Nil(t, err)
+	go processor.Flush()
+
+	// the flush is waiting for the retry backoff, close must not wait for it
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	assert.Nil(t, c.Close())
+	assert.True(t, time.Since(start) < time.Second)
+
+	// the rejected document is reported as failed
+	assert.Contains(t, deadLetter.String(), `"id":"1"`)
+	stats, err := c.BulkStats("person")
+	assert.Nil(t, err)
+	assert.Equal(t, BulkStats{Flushed: 1, Failed: 1, DeadLettered: 1}, stats)
+}
+
 func TestAddBulkProcessor(t *testing.T) {
 	bulkProcessor := BulkProcessor{
 		Name:          "my-bulk-processor",
@@ -0,0 +1,564 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	es "github.com/olivere/elastic/v7"
+)
+
+const (
+	defaultScanBatchSize = 1000
+	defaultScanKeepAlive = "1m"
+	scanCleanupTimeout   = 10 * time.Second
+)
+
+// Iterator walks the documents matched by Scan, one hit at a time
+//
+//	it := client.Scan(ctx, "campaign", query)
+//	defer it.Close()
+//
+//	for it.Next() {
+//		var campaign Campaign
+//		if err := it.Decode(&campaign); err != nil {
+//			...
+//		}
+//	}
+//
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator interface {
+	// Next advance to the next hit. It returns false when there is no more hit, an error occurs or the context
+	// is canceled, see Err.
+	Next() bool
+
+	// Hit returns the current hit
+	Hit() SearchHit
+
+	// Decode decode the source of the current hit into out
+	Decode(out interface{}) error
+
+	// Err returns the error stopping the iteration. It's nil when the iteration is finished.
+	Err() error
+
+	// Close release the point in time or the scroll context. It's called automatically when the iteration is
+	// finished, but must be called when the iteration is stopped early.
+	Close() error
+}
+
+// ScanOption configure Scan
+type ScanOption func(*scanOptions)
+
+type scanOptions struct {
+	batchSize      int
+	keepAlive      string
+	sorters        []es.Sorter
+	sourceIncludes []string
+	sourceExcludes []string
+	sliceID        int
+	sliceMax       int
+	scroll         bool
+}
+
+// WithBatchSize set the number of hits fetched per request. Default is 1000.
+func WithBatchSize(size int) ScanOption {
+	return func(o *scanOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithKeepAlive set how long the point in time or the scroll context is kept between requests, e.g. "5m".
+// Default is 1 minute.
+func WithKeepAlive(keepAlive string) ScanOption {
+	return func(o *scanOptions) {
+		o.keepAlive = keepAlive
+	}
+}
+
+// WithScanSort sort the hits. Default is _shard_doc, the most efficient order, available since elasticsearch 7.12.
+// With point in time, the sort must be unique per document, so add a tiebreaker field when needed.
+func WithScanSort(sorters ...es.Sorter) ScanOption {
+	return func(o *scanOptions) {
+		o.sorters = sorters
+	}
+}
+
+// WithSourceFields filter the fields of the returned source
+func WithSourceFields(includes []string, excludes []string) ScanOption {
+	return func(o *scanOptions) {
+		o.sourceIncludes = includes
+		o.sourceExcludes = excludes
+	}
+}
+
+// WithSlice only walks the slice id of max slices, so max iterators can walk the documents concurrently.
+// See ScanSlices.
+func WithSlice(id, max int) ScanOption {
+	return func(o *scanOptions) {
+		o.sliceID = id
+		o.sliceMax = max
+	}
+}
+
+// WithScroll use scroll instead of point in time
+func WithScroll() ScanOption {
+	return func(o *scanOptions) {
+		o.scroll = true
+	}
+}
+
+// Scan walks all documents in the index matching the query, e.g. for reindexing and exports, using point in time and
+// search_after. When the point in time is not supported by elasticsearch (before 7.10), or the default _shard_doc sort
+// is not supported (before 7.12), it falls back to scroll. Nil query matches all documents.
+func (c *Client) Scan(ctx context.Context, indexName string, query es.Query, options ...ScanOption) Iterator {
+	opts := scanOptions{
+		batchSize: defaultScanBatchSize,
+		keepAlive: defaultScanKeepAlive,
+	}
+
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if opts.batchSize <= 0 {
+		opts.batchSize = defaultScanBatchSize
+	}
+
+	return &scanIterator{
+		client:    c,
+		ctx:       ctx,
+		indexName: indexName,
+		query:     query,
+		opts:      opts,
+	}
+}
+
+// ScanSlices split the scan into slices iterators, to be walked concurrently, one goroutine per iterator.
+// The slices share one point in time, so they read the same snapshot. It's closed after all iterators are closed.
+func (c *Client) ScanSlices(ctx context.Context, indexName string, query es.Query, slices int, options ...ScanOption) []Iterator {
+	if slices <= 1 {
+		return []Iterator{c.Scan(ctx, indexName, query, options...)}
+	}
+
+	iterators := make([]Iterator, 0, slices)
+	for i := 0; i < slices; i++ {
+		iterators = append(iterators, c.Scan(ctx, indexName, query, append(options, WithSlice(i, slices))...))
+	}
+
+	pit := &sharedPointInTime{
+		client:    c,
+		indexName: indexName,
+		keepAlive: iterators[0].(*scanIterator).opts.keepAlive,
+		refs:      slices,
+	}
+
+	for _, it := range iterators {
+		it.(*scanIterator).pit = pit
+	}
+
+	return iterators
+}
+
+// sharedPointInTime is the point in time of ScanSlices. It's opened by the first slice fetching the hits, and closed
+// when the last slice releases it.
+type sharedPointInTime struct {
+	client    *Client
+	indexName string
+	keepAlive string
+
+	mu     sync.Mutex
+	opened bool
+	id     string
+	err    error
+	refs   int
+}
+
+func (p *sharedPointInTime) open(ctx context.Context) (id string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.opened {
+		p.opened = true
+		p.id, p.err = openPointInTime(ctx, p.client, p.indexName, p.keepAlive)
+	}
+
+	return p.id, p.err
+}
+
+func (p *sharedPointInTime) release(ctx context.Context) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refs--
+	if p.refs > 0 || p.id == "" {
+		return
+	}
+
+	err = closePointInTime(ctx, p.client, p.id)
+	p.id = ""
+
+	return
+}
+
+type scanIterator struct {
+	client    *Client
+	ctx       context.Context
+	indexName string
+	query     es.Query
+	opts      scanOptions
+
+	// pit is the point in time shared with the other slices of ScanSlices, released once by this iterator
+	pit         *sharedPointInTime
+	released    bool
+	mu          sync.Mutex
+	started     bool
+	done        bool
+	closed      bool
+	err         error
+	pitID       string
+	scroll      *es.ScrollService
+	searchAfter []interface{}
+	hits        []SearchHit
+	pos         int
+}
+
+func (it *scanIterator) Next() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.closed || it.err != nil {
+		return false
+	}
+
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		it.close()
+		return false
+	}
+
+	it.pos++
+	for it.pos >= len(it.hits) {
+		if it.done {
+			it.close()
+			return false
+		}
+
+		if err := it.fetch(); err != nil {
+			it.err = err
+			it.close()
+			return false
+		}
+	}
+
+	return true
+}
+
+func (it *scanIterator) Hit() SearchHit {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.pos < 0 || it.pos >= len(it.hits) {
+		return SearchHit{}
+	}
+
+	return it.hits[it.pos]
+}
+
+func (it *scanIterator) Decode(out interface{}) error {
+	hit := it.Hit()
+	if hit.Source == nil {
+		return fmt.Errorf("elastic: no current hit")
+	}
+
+	return json.Unmarshal(hit.Source, out)
+}
+
+func (it *scanIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	return it.err
+}
+
+func (it *scanIterator) Close() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	return it.close()
+}
+
+// close release the point in time or the scroll context, with a new context since ctx may be canceled already
+func (it *scanIterator) close() (err error) {
+	if it.closed {
+		return
+	}
+
+	it.closed = true
+	it.hits = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), scanCleanupTimeout)
+	defer cancel()
+
+	if it.scroll != nil {
+		return it.scroll.Clear(ctx)
+	}
+
+	return it.closePointInTime(ctx)
+}
+
+// closePointInTime close the point in time of this iterator, or release the shared one
+func (it *scanIterator) closePointInTime(ctx context.Context) (err error) {
+	if it.pit != nil {
+		if it.released {
+			return
+		}
+
+		it.released = true
+		it.pitID = ""
+		return it.pit.release(ctx)
+	}
+
+	if it.pitID == "" {
+		return
+	}
+
+	err = closePointInTime(ctx, it.client, it.pitID)
+	it.pitID = ""
+
+	return
+}
+
+func closePointInTime(ctx context.Context, client *Client, id string) (err error) {
+	_, err = client.esclient.PerformRequest(ctx, es.PerformRequestOptions{
+		Method:       http.MethodDelete,
+		Path:         "/_pit",
+		Body:         map[string]interface{}{"id": id},
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+
+	return
+}
+
+// fetch fetch the next batch of hits
+func (it *scanIterator) fetch() (err error) {
+	if !it.started {
+		it.started = true
+		if !it.opts.scroll {
+			if it.pit != nil {
+				it.pitID, err = it.pit.open(it.ctx)
+			} else {
+				it.pitID, err = openPointInTime(it.ctx, it.client, it.indexName, it.opts.keepAlive)
+			}
+
+			if isPointInTimeUnsupported(err) {
+				it.opts.scroll = true
+				err = nil
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	var result *es.SearchResult
+	if it.opts.scroll {
+		result, err = it.fetchScroll()
+	} else {
+		result, err = it.fetchPointInTime()
+		if len(it.opts.sorters) == 0 && len(it.searchAfter) == 0 && isShardDocUnsupported(err) {
+			// elasticsearch 7.10 & 7.11 have point in time but not _shard_doc, and _doc is not unique across shards
+			it.closePointInTime(it.ctx)
+			it.opts.scroll = true
+			result, err = it.fetchScroll()
+		}
+	}
+
+	if err == io.EOF {
+		it.hits, it.pos, it.done = nil, 0, true
+		return nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	it.hits = newSearchResult(result).Hits
+	it.pos = 0
+
+	if len(it.hits) < it.opts.batchSize {
+		it.done = true
+	}
+
+	if len(it.hits) > 0 {
+		it.searchAfter = it.hits[len(it.hits)-1].Sort
+	}
+
+	return
+}
+
+func openPointInTime(ctx context.Context, client *Client, indexName string, keepAlive string) (id string, err error) {
+	res, err := client.esclient.PerformRequest(ctx, es.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   fmt.Sprintf("/%s/_pit", url.PathEscape(indexName)),
+		Params: url.Values{"keep_alive": []string{keepAlive}},
+	})
+	if err != nil {
+		return
+	}
+
+	var pit struct {
+		ID string `json:"id"`
+	}
+
+	if err = json.Unmarshal(res.Body, &pit); err != nil {
+		return
+	}
+
+	return pit.ID, nil
+}
+
+func (it *scanIterator) fetchPointInTime() (result *es.SearchResult, err error) {
+	source := es.NewSearchSource().Size(it.opts.batchSize)
+	if it.query != nil {
+		source = source.Query(it.query)
+	}
+
+	if len(it.opts.sorters) > 0 {
+		source = source.SortBy(it.opts.sorters...)
+	} else {
+		source = source.SortBy(es.NewFieldSort("_shard_doc"))
+	}
+
+	if len(it.opts.sourceIncludes) > 0 || len(it.opts.sourceExcludes) > 0 {
+		source = source.FetchSourceContext(es.NewFetchSourceContext(true).
+			Include(it.opts.sourceIncludes...).
+			Exclude(it.opts.sourceExcludes...))
+	}
+
+	if it.opts.sliceMax > 1 {
+		source = source.Slice(es.NewSliceQuery().Id(it.opts.sliceID).Max(it.opts.sliceMax))
+	}
+
+	if len(it.searchAfter) > 0 {
+		source = source.SearchAfter(it.searchAfter...)
+	}
+
+	src, err := source.Source()
+	if err != nil {
+		return
+	}
+
+	body, ok := src.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("elastic: unexpected search source %T", src)
+	}
+
+	body["pit"] = map[string]interface{}{
+		"id":         it.pitID,
+		"keep_alive": it.opts.keepAlive,
+	}
+
+	res, err := it.client.esclient.PerformRequest(it.ctx, es.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/_search",
+		Body:   body,
+	})
+	if err != nil {
+		return
+	}
+
+	var response struct {
+		es.SearchResult
+		PitID string `json:"pit_id"`
+	}
+
+	if err = json.Unmarshal(res.Body, &response); err != nil {
+		return
+	}
+
+	// the point in time id may change between requests
+	if response.PitID != "" {
+		it.pitID = response.PitID
+	}
+
+	return &response.SearchResult, nil
+}
+
+func (it *scanIterator) fetchScroll() (result *es.SearchResult, err error) {
+	if it.scroll == nil {
+		it.scroll = it.client.esclient.Scroll(it.indexName).
+			Size(it.opts.batchSize).
+			KeepAlive(it.opts.keepAlive)
+
+		if it.query != nil {
+			it.scroll = it.scroll.Query(it.query)
+		}
+
+		if len(it.opts.sorters) > 0 {
+			it.scroll = it.scroll.SortBy(it.opts.sorters...)
+		} else {
+			it.scroll = it.scroll.SortBy(es.SortByDoc{})
+		}
+
+		if len(it.opts.sourceIncludes) > 0 || len(it.opts.sourceExcludes) > 0 {
+			it.scroll = it.scroll.FetchSourceContext(es.NewFetchSourceContext(true).
+				Include(it.opts.sourceIncludes...).
+				Exclude(it.opts.sourceExcludes...))
+		}
+
+		if it.opts.sliceMax > 1 {
+			it.scroll = it.scroll.Slice(es.NewSliceQuery().Id(it.opts.sliceID).Max(it.opts.sliceMax))
+		}
+	}
+
+	return it.scroll.Do(it.ctx)
+}
+
+// isPointInTimeUnsupported check whether opening the point in time failed because elasticsearch doesn't have the api.
+// Unknown endpoint is rejected by the rest layer with 405 "Incorrect HTTP method" or 400 "no handler found", whose
+// error is a plain string, so it has no details. Other errors, e.g. invalid keep alive or closed index, have details.
+func isPointInTimeUnsupported(err error) bool {
+	e, ok := err.(*es.Error)
+	if !ok {
+		return false
+	}
+
+	switch e.Status {
+	case http.StatusMethodNotAllowed:
+		return true
+	case http.StatusBadRequest:
+		// before 7.0 the _pit part of the path is taken as mapping type
+		return e.Details == nil || e.Details.Type == "invalid_type_name_exception"
+	}
+
+	return false
+}
+
+// isShardDocUnsupported check whether the point in time search failed because _shard_doc sort is not supported
+func isShardDocUnsupported(err error) bool {
+	e, ok := err.(*es.Error)
+	if !ok || e.Status != http.StatusBadRequest || e.Details == nil {
+		return false
+	}
+
+	if strings.Contains(e.Details.Reason, "_shard_doc") {
+		return true
+	}
+
+	for _, cause := range e.Details.RootCause {
+		if cause != nil && strings.Contains(cause.Reason, "_shard_doc") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+
+	es "github.com/olivere/elastic/v7"
+)
+
+// SearchResult is the typed result of SearchHits
+type SearchResult struct {
+	// Total is the total number of matching documents. TotalRelation is "eq" when Total is exact,
+	// or "gte" when it's the lower bound.
+	Total         int64
+	TotalRelation string
+	MaxScore      *float64
+	TookInMillis  int64
+	Hits          []SearchHit
+
+	// Aggregations is the raw aggregation results by name. Use AggregationInto to decode it.
+	Aggregations map[string]json.RawMessage
+}
+
+// SearchHit is a matching document
+type SearchHit struct {
+	Index     string
+	ID        string
+	Score     *float64
+	Source    json.RawMessage
+	Highlight map[string][]string
+
+	// Sort is the sort values of the hit, used as SearchOption.SearchAfter to get the next page
+	Sort []interface{}
+}
+
+// AggregationInto decode the aggregation result by name into out. It returns false when the aggregation is not found.
+func (r *SearchResult) AggregationInto(name string, out interface{}) (found bool, err error) {
+	raw, found := r.Aggregations[name]
+	if !found {
+		return
+	}
+
+	err = json.Unmarshal(raw, out)
+	return
+}
+
+// LastSort returns the sort values of the last hit, to be used as SearchOption.SearchAfter for the next page.
+// It returns nil when there is no hit.
+func (r *SearchResult) LastSort() []interface{} {
+	if len(r.Hits) == 0 {
+		return nil
+	}
+
+	return r.Hits[len(r.Hits)-1].Sort
+}
+
+// Sources returns the source of the hits as json array
+func (r *SearchResult) Sources() (result []byte, err error) {
+	sources := make([]json.RawMessage, 0, len(r.Hits))
+	for _, hit := range r.Hits {
+		sources = append(sources, hit.Source)
+	}
+
+	return json.Marshal(sources)
+}
+
+// SearchHits search the documents and returns the hits with their id, score, source, highlight and sort values,
+// the total count and the aggregations
+func (c *Client) SearchHits(ctx context.Context, indexName string, option SearchOption) (result *SearchResult, err error) {
+	searchResult, err := c.newSearch(indexName, option).Do(ctx)
+	if err != nil {
+		return
+	}
+
+	return newSearchResult(searchResult), nil
+}
+
+// SearchInto search the documents and decode the source of the hits into out, a pointer to slice,
+// e.g. &[]Campaign{}. The result is returned for the total count, aggregations and sort values.
+func (c *Client) SearchInto(ctx context.Context, indexName string, option SearchOption, out interface{}) (result *SearchResult, err error) {
+	result, err = c.SearchHits(ctx, indexName, option)
+	if err != nil {
+		return
+	}
+
+	sources, err := result.Sources()
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(sources, out)
+	return
+}
+
+func (c *Client) newSearch(indexName string, option SearchOption) *es.SearchService {
+	if option.Size == 0 {
+		option.Size = 10 // default size to 10
+	}
+
+	if option.Size < 0 {
+		option.Size = 0 // no hits, e.g. aggregations only
+	}
+
+	search := c.esclient.Search().
+		Index(indexName).
+		From(option.From).
+		Size(option.Size)
+
+	if option.Query != nil {
+		search = search.Query(option.Query)
+	}
+
+	for k, v := range option.Sort {
+		search = search.Sort(k, v)
+	}
+
+	if len(option.Sorters) > 0 {
+		search = search.SortBy(option.Sorters...)
+	}
+
+	if len(option.SourceIncludes) > 0 || len(option.SourceExcludes) > 0 {
+		search = search.FetchSourceContext(es.NewFetchSourceContext(true).
+			Include(option.SourceIncludes...).
+			Exclude(option.SourceExcludes...))
+	}
+
+	if option.Highlight != nil {
+		search = search.Highlight(option.Highlight)
+	}
+
+	for name, aggregation := range option.Aggregations {
+		search = search.Aggregation(name, aggregation)
+	}
+
+	if len(option.SearchAfter) > 0 {
+		search = search.SearchAfter(option.SearchAfter...)
+	}
+
+	if option.TrackTotalHits {
+		search = search.TrackTotalHits(true)
+	}
+
+	return search
+}
+
+func newSearchResult(searchResult *es.SearchResult) (result *SearchResult) {
+	result = &SearchResult{
+		TookInMillis: searchResult.TookInMillis,
+		Aggregations: make(map[string]json.RawMessage),
+	}
+
+	for name, aggregation := range searchResult.Aggregations {
+		result.Aggregations[name] = aggregation
+	}
+
+	if searchResult.Hits == nil {
+		return
+	}
+
+	if total := searchResult.Hits.TotalHits; total != nil {
+		result.Total = total.Value
+		result.TotalRelation = total.Relation
+	}
+
+	result.MaxScore = searchResult.Hits.MaxScore
+
+	for _, hit := range searchResult.Hits.Hits {
+		result.Hits = append(result.Hits, SearchHit{
+			Index:     hit.Index,
+			ID:        hit.Id,
+			Score:     hit.Score,
+			Source:    hit.Source,
+			Highlight: hit.Highlight,
+			Sort:      hit.Sort,
+		})
+	}
+
+	return
+}
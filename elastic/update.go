@@ -0,0 +1,284 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	es "github.com/olivere/elastic/v7"
+)
+
+const (
+	defaultTaskPollInterval = time.Second
+	defaultRetryOnConflict  = 3
+)
+
+// Script is painless script with its params, e.g.
+//
+//	Script{
+//		Source: "ctx._source.amount += params.amount",
+//		Params: map[string]interface{}{"amount": 10000},
+//	}
+type Script struct {
+	Source string
+	Params map[string]interface{}
+}
+
+func (s *Script) esScript() *es.Script {
+	script := es.NewScript(s.Source).Lang("painless")
+	if len(s.Params) > 0 {
+		script = script.Params(s.Params)
+	}
+
+	return script
+}
+
+// ByQueryOption is the option of UpdateByQuery and DeleteByQuery
+type ByQueryOption struct {
+	// Query select the documents. Nil query matches all documents.
+	Query es.Query
+
+	// Script update the documents, only used by UpdateByQuery. Nil script reindex the documents as is,
+	// e.g. to pick up the new mappings.
+	Script *Script
+
+	// ProceedOnConflict count the version conflicts instead of aborting the operation
+	ProceedOnConflict bool
+
+	// Slices split the operation into slices, run in parallel
+	Slices int
+
+	// PollInterval is the interval of checking the task. Default is 1 second.
+	PollInterval time.Duration
+}
+
+// Update partially update the document, only the fields in doc are changed
+func (c *Client) Update(ctx context.Context, indexName string, id string, doc interface{}) (res *es.UpdateResponse, err error) {
+	res, err = c.esclient.Update().
+		Index(indexName).
+		Id(id).
+		Doc(doc).
+		RetryOnConflict(defaultRetryOnConflict).
+		Do(ctx)
+	return
+}
+
+// Upsert run the painless script on the document. When the document doesn't exist, upsert is indexed as the new
+// document. With nil upsert, the script runs on empty document instead, so it can initialize the fields.
+func (c *Client) Upsert(ctx context.Context, indexName string, id string, script Script, upsert interface{}) (res *es.UpdateResponse, err error) {
+	update := c.esclient.Update().
+		Index(indexName).
+		Id(id).
+		Script(script.esScript()).
+		RetryOnConflict(defaultRetryOnConflict)
+
+	if upsert == nil {
+		update = update.ScriptedUpsert(true).Upsert(map[string]interface{}{})
+	} else {
+		update = update.Upsert(upsert)
+	}
+
+	res, err = update.Do(ctx)
+	return
+}
+
+// UpdateByQuery update the documents matching the query with the script. It runs as elasticsearch task, polled until
+// it's completed, so it doesn't time out on large index. When ctx is done, the task keeps running.
+func (c *Client) UpdateByQuery(ctx context.Context, indexName string, option ByQueryOption) (res *es.BulkIndexByScrollResponse, err error) {
+	update := c.esclient.UpdateByQuery(indexName).Query(matchAllIfNil(option.Query))
+	if option.Script != nil {
+		update = update.Script(option.Script.esScript())
+	}
+
+	if option.ProceedOnConflict {
+		update = update.ProceedOnVersionConflict()
+	}
+
+	if option.Slices > 1 {
+		update = update.Slices(option.Slices)
+	}
+
+	task, err := update.DoAsync(ctx)
+	if err != nil {
+		return
+	}
+
+	return c.waitForTask(ctx, task.TaskId, option.PollInterval)
+}
+
+// DeleteByQuery delete the documents matching the query. It runs as elasticsearch task, polled until it's completed,
+// so it doesn't time out on large index. When ctx is done, the task keeps running.
+func (c *Client) DeleteByQuery(ctx context.Context, indexName string, option ByQueryOption) (res *es.BulkIndexByScrollResponse, err error) {
+	remove := c.esclient.DeleteByQuery(indexName).Query(matchAllIfNil(option.Query))
+	if option.ProceedOnConflict {
+		remove = remove.ProceedOnVersionConflict()
+	}
+
+	if option.Slices > 1 {
+		remove = remove.Slices(option.Slices)
+	}
+
+	task, err := remove.DoAsync(ctx)
+	if err != nil {
+		return
+	}
+
+	return c.waitForTask(ctx, task.TaskId, option.PollInterval)
+}
+
+// Get get the document by id and decode its source into out. Found is false when the document doesn't exist.
+func (c *Client) Get(ctx context.Context, indexName string, id string, out interface{}) (found bool, err error) {
+	res, err := c.esclient.Get().
+		Index(indexName).
+		Id(id).
+		Do(ctx)
+	if es.IsNotFound(err) {
+		return false, nil
+	}
+
+	if err != nil || !res.Found {
+		return
+	}
+
+	return true, json.Unmarshal(res.Source, out)
+}
+
+// MultiGet get the documents by ids and decode their sources into out, a pointer to slice, e.g. &[]Campaign{}.
+// The documents that don't exist are skipped, foundIDs returns the ids of the decoded documents in the same order.
+func (c *Client) MultiGet(ctx context.Context, indexName string, ids []string, out interface{}) (foundIDs []string, err error) {
+	if len(ids) == 0 {
+		return nil, json.Unmarshal([]byte("[]"), out)
+	}
+
+	mget := c.esclient.MultiGet()
+	for _, id := range ids {
+		mget = mget.Add(es.NewMultiGetItem().Index(indexName).Id(id))
+	}
+
+	res, err := mget.Do(ctx)
+	if err != nil {
+		return
+	}
+
+	sources := make([]json.RawMessage, 0, len(res.Docs))
+	for _, doc := range res.Docs {
+		if doc == nil || !doc.Found {
+			continue
+		}
+
+		foundIDs = append(foundIDs, doc.Id)
+		sources = append(sources, doc.Source)
+	}
+
+	result, err := json.Marshal(sources)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(result, out)
+	return
+}
+
+// BulkUpdate bulk partially update the documents by their id, only the fields in the documents are changed.
+// The document must have the id field, see BulkStore.
+func (c *Client) BulkUpdate(ctx context.Context, indexName string, processorName string, docs []interface{}) (err error) {
+	processor, err := c.GetBulkProcessor(processorName)
+	if err != nil {
+		return
+	}
+
+	requests := make([]es.BulkableRequest, 0, len(docs))
+	for _, doc := range docs {
+		id := getDocumentID(doc)
+		if id == "" {
+			return fmt.Errorf("elastic: document %v has no id to be updated", doc)
+		}
+
+		requests = append(requests, es.NewBulkUpdateRequest().
+			Index(indexName).
+			Id(id).
+			Doc(doc).
+			RetryOnConflict(defaultRetryOnConflict))
+	}
+
+	for _, req := range requests {
+		processor.Add(req)
+	}
+
+	return
+}
+
+// BulkRemove bulk delete the documents by ids
+func (c *Client) BulkRemove(ctx context.Context, indexName string, processorName string, ids []string) (err error) {
+	processor, err := c.GetBulkProcessor(processorName)
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		processor.Add(es.NewBulkDeleteRequest().Index(indexName).Id(id))
+	}
+
+	return
+}
+
+// waitForTask poll the task until it's completed, then returns its response
+func (c *Client) waitForTask(ctx context.Context, taskID string, interval time.Duration) (res *es.BulkIndexByScrollResponse, err error) {
+	if interval <= 0 {
+		interval = defaultTaskPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var completed bool
+	for {
+		completed, res, err = c.getTask(ctx, taskID)
+		if err != nil || completed {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("elastic: stop waiting for task %s: %w", taskID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) getTask(ctx context.Context, taskID string) (completed bool, res *es.BulkIndexByScrollResponse, err error) {
+	resp, err := c.esclient.PerformRequest(ctx, es.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   fmt.Sprintf("/_tasks/%s", url.PathEscape(taskID)),
+	})
+	if err != nil {
+		return
+	}
+
+	var task struct {
+		Completed bool                          `json:"completed"`
+		Response  *es.BulkIndexByScrollResponse `json:"response"`
+		Error     *es.ErrorDetails              `json:"error"`
+	}
+
+	if err = json.Unmarshal(resp.Body, &task); err != nil {
+		return
+	}
+
+	if task.Error != nil {
+		return true, task.Response, fmt.Errorf("elastic: task %s failed: %s: %s", taskID, task.Error.Type, task.Error.Reason)
+	}
+
+	return task.Completed, task.Response, nil
+}
+
+func matchAllIfNil(query es.Query) es.Query {
+	if query == nil {
+		return es.NewMatchAllQuery()
+	}
+
+	return query
+}
@@ -0,0 +1,183 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+const maxStackDepth = 32
+
+// Frame is a function call in the stack trace
+type Frame struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// stack is the program counters where the error is created
+type stack []uintptr
+
+func callers() stack {
+	var pcs [maxStackDepth]uintptr
+	// skip runtime.Callers, callers and the constructor of this package
+	n := runtime.Callers(3, pcs[:])
+	return pcs[:n]
+}
+
+func (s stack) frames() (frames []Frame) {
+	callersFrames := runtime.CallersFrames(s)
+	for {
+		frame, more := callersFrames.Next()
+		frames = append(frames, Frame{
+			Func: frame.Function,
+			File: frame.File,
+			Line: frame.Line,
+		})
+
+		if !more {
+			return
+		}
+	}
+}
+
+type withStack struct {
+	error
+	stack stack
+}
+
+func (e *withStack) Unwrap() error {
+	return e.error
+}
+
+type wrapped struct {
+	msg   string
+	cause error
+	stack stack
+}
+
+func (e *wrapped) Error() string {
+	return e.msg + ": " + e.cause.Error()
+}
+
+func (e *wrapped) Unwrap() error {
+	return e.cause
+}
+
+// New returns an error with the message and the stack trace where it's called
+func New(msg string) error {
+	return &withStack{
+		error: errors.New(msg),
+		stack: callers(),
+	}
+}
+
+// Errorf is like fmt.Errorf, with the stack trace where it's called. The %w verb is supported.
+func Errorf(format string, args ...interface{}) error {
+	return &withStack{
+		error: fmt.Errorf(format, args...),
+		stack: callers(),
+	}
+}
+
+// WithStack returns err with the stack trace where it's called. err is returned as is when it's nil or already has
+// a stack trace, so the stack trace points to where the error is created.
+func WithStack(err error) error {
+	if err == nil || hasStack(err) {
+		return err
+	}
+
+	return &withStack{
+		error: err,
+		stack: callers(),
+	}
+}
+
+// Wrap returns an error with the message "msg: err", unwrapping to err. The stack trace is recorded when err doesn't
+// have one. Wrap returns nil when err is nil.
+func Wrap(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+
+	w := &wrapped{
+		msg:   msg,
+		cause: err,
+	}
+
+	if !hasStack(err) {
+		w.stack = callers()
+	}
+
+	return w
+}
+
+// Wrapf is like Wrap with formatted message
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	w := &wrapped{
+		msg:   fmt.Sprintf(format, args...),
+		cause: err,
+	}
+
+	if !hasStack(err) {
+		w.stack = callers()
+	}
+
+	return w
+}
+
+// StackTrace returns the stack trace of the innermost error in the chain having one, which is where the error is
+// created. It returns nil when no error in the chain has stack trace.
+func StackTrace(err error) (frames []Frame) {
+	var s stack
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *withStack:
+			s = e.stack
+		case *wrapped:
+			if e.stack != nil {
+				s = e.stack
+			}
+		}
+	}
+
+	if s == nil {
+		return nil
+	}
+
+	return s.frames()
+}
+
+func hasStack(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *withStack:
+			return true
+		case *wrapped:
+			if e.stack != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Is reports whether any error in err's chain matches target. See the standard errors.Is.
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As finds the first error in err's chain that matches target. See the standard errors.As.
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// Unwrap returns the result of calling the Unwrap method on err. See the standard errors.Unwrap.
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
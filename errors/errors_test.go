@@ -0,0 +1,45 @@
+package errors
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+func findCampaign() error {
+	return WithStack(errNotFound)
+}
+
+func TestWrapChain(t *testing.T) {
+	err := Wrap(Wrapf(findCampaign(), "campaign %d", 10), "create donation")
+
+	assert.Equal(t, "create donation: campaign 10: not found", err.Error())
+	assert.True(t, Is(err, errNotFound))
+	assert.Nil(t, Wrap(nil, "create donation"))
+	assert.Nil(t, WithStack(nil))
+
+	frames := StackTrace(err)
+	if assert.NotEmpty(t, frames) {
+		assert.True(t, strings.HasSuffix(frames[0].Func, "errors.findCampaign"), "stack trace should point to where the error is created, got %s", frames[0].Func)
+		assert.True(t, strings.HasSuffix(frames[0].File, "errors_test.go"))
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	assert.Nil(t, StackTrace(errNotFound))
+
+	err := Errorf("find campaign: %w", errNotFound)
+	assert.True(t, Is(err, errNotFound))
+	assert.True(t, strings.HasSuffix(StackTrace(err)[0].Func, "errors.TestStackTrace"))
+
+	// wrapping the error without stack records the stack where it's wrapped
+	err = Wrap(errNotFound, "find campaign")
+	assert.True(t, strings.HasSuffix(StackTrace(err)[0].Func, "errors.TestStackTrace"))
+
+	withStack := New("timeout")
+	assert.Equal(t, withStack, WithStack(withStack), "stack should not be replaced")
+}
@@ -20,6 +20,10 @@ func NewContextHandler(meta structs.Meta) HttpHandlerContext {
 		structs.ErrInvalidHeader:          structs.ErrInvalidHeader,
 		structs.ErrUnauthorized:           structs.ErrUnauthorized,
 		structs.ErrInvalidHeaderSignature: structs.ErrInvalidHeaderSignature,
+		structs.ErrExpiredHeaderTime:      structs.ErrExpiredHeaderTime,
+		structs.ErrReplayedRequest:        structs.ErrReplayedRequest,
+		structs.ErrServiceUnavailable:     structs.ErrServiceUnavailable,
+		structs.ErrRequestTooLarge:        structs.ErrRequestTooLarge,
 	}
 
 	return HttpHandlerContext{
@@ -111,10 +115,14 @@ func writeErrorResponse(w http.ResponseWriter, errorResponse *structs.ErrorRespo
 	writeResponse(w, errorResponse, "application/json", errorResponse.HttpStatus)
 }
 
-// LookupError will get error message based on error type, with variables if you want give dynamic message error
+// LookupError will get error message based on error type, with variables if you want give dynamic message error.
+// When err is not registered, the errors it wraps are looked up in order, so the closest registered error is used.
 func LookupError(lookup map[error]*structs.ErrorResponse, err error) (res *structs.ErrorResponse) {
-	if msg, ok := lookup[err]; ok {
-		res = msg
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if msg, ok := lookup[e]; ok {
+			res = msg
+			return
+		}
 	}
 
 	return
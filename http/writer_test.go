@@ -0,0 +1,29 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kitabisa/perkakas/v2/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupErrorClosestWrapped(t *testing.T) {
+	errQuotaExceeded := fmt.Errorf("quota exceeded: %w", structs.ErrServiceUnavailable)
+	errResponse := &structs.ErrorResponse{HttpStatus: http.StatusTooManyRequests}
+
+	hctx := NewContextHandler(structs.Meta{})
+	hctx.AddError(errQuotaExceeded, errResponse)
+
+	// both errQuotaExceeded and structs.ErrServiceUnavailable in the chain are registered, the closest one is used
+	err := fmt.Errorf("donate: %w", errQuotaExceeded)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, errResponse, LookupError(hctx.E, err))
+	}
+
+	err = fmt.Errorf("donate: %w", structs.ErrServiceUnavailable)
+	assert.Equal(t, structs.ErrServiceUnavailable, LookupError(hctx.E, err))
+	assert.Nil(t, LookupError(hctx.E, errors.New("unknown")))
+}
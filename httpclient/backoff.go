@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy is the strategy for waiting between retries
+type BackoffPolicy int
+
+const (
+	// ConstantBackoff wait BackoffInterval plus random jitter up to MaximumJitterInterval
+	ConstantBackoff BackoffPolicy = iota
+
+	// ExponentialBackoff wait BackoffInterval * 2^(retry-1), capped by MaximumBackoffInterval,
+	// plus random jitter up to MaximumJitterInterval
+	ExponentialBackoff
+
+	// DecorrelatedJitterBackoff wait random duration between BackoffInterval and 3 times the previous wait,
+	// capped by MaximumBackoffInterval
+	DecorrelatedJitterBackoff
+)
+
+const defaultMaximumBackoffInterval = 10 * time.Second
+
+type backoff interface {
+	// next returns the wait duration before retry, previous is the last wait duration
+	next(retry int, previous time.Duration) time.Duration
+}
+
+func newBackoff(conf *HttpClientConf) backoff {
+	maxInterval := conf.MaximumBackoffInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultMaximumBackoffInterval
+	}
+
+	switch conf.BackoffPolicy {
+	case ExponentialBackoff:
+		return &exponentialBackoff{
+			interval:    conf.BackoffInterval,
+			maxInterval: maxInterval,
+			maxJitter:   conf.MaximumJitterInterval,
+		}
+	case DecorrelatedJitterBackoff:
+		return &decorrelatedJitterBackoff{
+			interval:    conf.BackoffInterval,
+			maxInterval: maxInterval,
+		}
+	default:
+		return &constantBackoff{
+			interval:  conf.BackoffInterval,
+			maxJitter: conf.MaximumJitterInterval,
+		}
+	}
+}
+
+type constantBackoff struct {
+	interval  time.Duration
+	maxJitter time.Duration
+}
+
+func (b *constantBackoff) next(retry int, previous time.Duration) time.Duration {
+	return b.interval + jitter(b.maxJitter)
+}
+
+type exponentialBackoff struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	maxJitter   time.Duration
+}
+
+func (b *exponentialBackoff) next(retry int, previous time.Duration) time.Duration {
+	wait := float64(b.interval) * math.Pow(2, float64(retry-1))
+	wait = math.Min(wait, float64(b.maxInterval))
+
+	return time.Duration(wait) + jitter(b.maxJitter)
+}
+
+type decorrelatedJitterBackoff struct {
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+func (b *decorrelatedJitterBackoff) next(retry int, previous time.Duration) time.Duration {
+	if previous < b.interval {
+		previous = b.interval
+	}
+
+	wait := b.interval + jitter(3*previous-b.interval)
+	if wait > b.maxInterval {
+		wait = b.maxInterval
+	}
+
+	return wait
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,207 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/structs"
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed let every request through
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen reject every request until OpenTimeout passed
+	CircuitOpen
+
+	// CircuitHalfOpen let HalfOpenMaxRequests requests through to check whether the host has recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerConf is the configuration of circuit breaker. Each host has its own circuit.
+type CircuitBreakerConf struct {
+	// FailureThreshold is the consecutive failures that open the circuit. Default is 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long the circuit stay open before it become half-open. Default is 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenMaxRequests is the requests allowed on half-open state. The circuit is closed when all of them success,
+	// and opened again when any of them fail. Default is 1.
+	HalfOpenMaxRequests int
+
+	// IsFailure decide whether the response is a failure. Default is error or 5xx status code.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// CircuitOpenError is returned without sending the request when the circuit of the host is open.
+// It unwraps to structs.ErrServiceUnavailable, so phttp.CustomWriter writes it as 503 response.
+type CircuitOpenError struct {
+	Host string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("httpclient: circuit breaker is open for host %s", e.Host)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return structs.ErrServiceUnavailable
+}
+
+type circuit struct {
+	state            CircuitState
+	failures         int
+	halfOpenRequests int
+	halfOpenSuccess  int
+	openedAt         time.Time
+}
+
+type circuitBreakerDoer struct {
+	doer     heimdall.Doer
+	conf     CircuitBreakerConf
+	circuits map[string]*circuit
+	mutex    sync.Mutex
+}
+
+func newCircuitBreakerDoer(doer heimdall.Doer, conf CircuitBreakerConf) *circuitBreakerDoer {
+	if conf.FailureThreshold <= 0 {
+		conf.FailureThreshold = 5
+	}
+
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = 30 * time.Second
+	}
+
+	if conf.HalfOpenMaxRequests <= 0 {
+		conf.HalfOpenMaxRequests = 1
+	}
+
+	if conf.IsFailure == nil {
+		conf.IsFailure = isFailure
+	}
+
+	return &circuitBreakerDoer{
+		doer:     doer,
+		conf:     conf,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+func (d *circuitBreakerDoer) Do(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if !d.allow(host) {
+		return nil, &CircuitOpenError{Host: host}
+	}
+
+	resp, err := d.doer.Do(req)
+	d.record(host, !d.conf.IsFailure(resp, err))
+
+	return resp, err
+}
+
+// State returns the circuit state of the host
+func (d *circuitBreakerDoer) State(host string) CircuitState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.circuit(host).currentState(d.conf.OpenTimeout)
+}
+
+func (d *circuitBreakerDoer) allow(host string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c := d.circuit(host)
+	switch c.currentState(d.conf.OpenTimeout) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if c.state == CircuitOpen {
+			c.state = CircuitHalfOpen
+			c.halfOpenRequests = 0
+			c.halfOpenSuccess = 0
+		}
+
+		if c.halfOpenRequests >= d.conf.HalfOpenMaxRequests {
+			return false
+		}
+
+		c.halfOpenRequests++
+	}
+
+	return true
+}
+
+func (d *circuitBreakerDoer) record(host string, success bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c := d.circuit(host)
+	switch c.state {
+	case CircuitClosed:
+		if success {
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= d.conf.FailureThreshold {
+			c.open()
+		}
+	case CircuitHalfOpen:
+		if !success {
+			c.open()
+			return
+		}
+
+		c.halfOpenSuccess++
+		if c.halfOpenSuccess >= d.conf.HalfOpenMaxRequests {
+			*c = circuit{state: CircuitClosed}
+		}
+	}
+}
+
+func (d *circuitBreakerDoer) circuit(host string) *circuit {
+	c, ok := d.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		d.circuits[host] = c
+	}
+
+	return c
+}
+
+func (c *circuit) open() {
+	c.state = CircuitOpen
+	c.openedAt = time.Now()
+	c.failures = 0
+}
+
+func (c *circuit) currentState(openTimeout time.Duration) CircuitState {
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= openTimeout {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+func isFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
@@ -1,14 +1,21 @@
 package httpclient
 
 import (
+	"io"
+	"net/http"
 	"time"
 
 	"github.com/gojektech/heimdall"
 	"github.com/gojektech/heimdall/httpclient"
+	"github.com/kitabisa/perkakas/v2/tracing"
 )
 
 type HttpClient struct {
 	Client *httpclient.Client
+
+	doer           heimdall.Doer
+	circuitBreaker *circuitBreakerDoer
+	logging        *LoggingDoer
 }
 
 type HttpClientConf struct {
@@ -16,6 +23,34 @@ type HttpClientConf struct {
 	MaximumJitterInterval time.Duration
 	Timeout               time.Duration
 	RetryCount            int
+
+	// BackoffPolicy is the strategy for waiting between retries. Default is ConstantBackoff.
+	BackoffPolicy BackoffPolicy
+
+	// MaximumBackoffInterval cap the wait of ExponentialBackoff and DecorrelatedJitterBackoff. Default is 10 seconds.
+	MaximumBackoffInterval time.Duration
+
+	// RetryMethods is the methods that can be retried. Default is DefaultRetryMethods, non-idempotent POST and PATCH are not retried.
+	RetryMethods []string
+
+	// RetryStatusCodes is the response status codes that are retried. Default is DefaultRetryStatusCodes.
+	// Request that failed without response is always retried.
+	RetryStatusCodes []int
+
+	// RetryBudget limit the retries relative to the requests. Nil means no limit.
+	RetryBudget *RetryBudget
+
+	// Signer sign every outbound request when it's not nil
+	Signer *SignerConf
+
+	// CircuitBreaker enable circuit breaker per host when it's not nil
+	CircuitBreaker *CircuitBreakerConf
+
+	// Logging log every request attempt and export the latency when it's not nil
+	Logging *LoggingConf
+
+	// Tracer trace every request attempt and propagate the trace with W3C traceparent header when it's not nil
+	Tracer *tracing.Tracer
 }
 
 func NewHttpClient(conf *HttpClientConf) *HttpClient {
@@ -25,18 +60,11 @@ func NewHttpClient(conf *HttpClientConf) *HttpClient {
 		conf = getDefaultHttpClientConf()
 	}
 
-	backoff := heimdall.NewConstantBackoff(conf.BackoffInterval, conf.MaximumJitterInterval)
-	retrier := heimdall.NewRetrier(backoff)
-
-	newClient := httpclient.NewClient(
-		httpclient.WithHTTPTimeout(conf.Timeout),
-		httpclient.WithRetrier(retrier),
-		httpclient.WithRetryCount(conf.RetryCount),
-	)
-
-	return &HttpClient{
-		Client: newClient,
+	doer := &http.Client{
+		Timeout: conf.Timeout,
 	}
+
+	return newHttpClient(conf, doer)
 }
 
 func NewHttpWithCustomClient(conf *HttpClientConf, doer heimdall.Doer) *HttpClient {
@@ -46,21 +74,110 @@ func NewHttpWithCustomClient(conf *HttpClientConf, doer heimdall.Doer) *HttpClie
 		conf = getDefaultHttpClientConf()
 	}
 
-	backoff := heimdall.NewConstantBackoff(conf.BackoffInterval, conf.MaximumJitterInterval)
-	retrier := heimdall.NewRetrier(backoff)
+	return newHttpClient(conf, doer)
+}
+
+func newHttpClient(conf *HttpClientConf, doer heimdall.Doer) *HttpClient {
+	var logging *LoggingDoer
+	if conf.Logging != nil {
+		logging = NewLoggingDoer(doer, *conf.Logging)
+		doer = logging
+	}
+
+	if conf.Signer != nil {
+		doer = NewSigningDoer(doer, *conf.Signer)
+	}
+
+	if conf.Tracer != nil {
+		doer = NewTracingDoer(doer, conf.Tracer)
+	}
+
+	doer = newRequestIDDoer(doer)
+
+	var circuitBreaker *circuitBreakerDoer
+	if conf.CircuitBreaker != nil {
+		circuitBreaker = newCircuitBreakerDoer(doer, *conf.CircuitBreaker)
+		doer = circuitBreaker
+	}
+
+	doer = newRetryDoer(doer, conf)
 
+	// retry is handled by retryDoer, since heimdall retries every method and every 5xx status code
 	newClient := httpclient.NewClient(
 		httpclient.WithHTTPTimeout(conf.Timeout),
-		httpclient.WithRetrier(retrier),
-		httpclient.WithRetryCount(conf.RetryCount),
+		httpclient.WithRetryCount(0),
 		httpclient.WithHTTPClient(doer),
 	)
 
 	return &HttpClient{
-		Client: newClient,
+		Client:         newClient,
+		doer:           doer,
+		circuitBreaker: circuitBreaker,
+		logging:        logging,
 	}
 }
 
+// Do send the request. Unlike Client.Do, the returned error keep its type, e.g. *CircuitOpenError
+func (h *HttpClient) Do(req *http.Request) (*http.Response, error) {
+	return h.doer.Do(req)
+}
+
+// Get send GET request through Do, so the returned error keep its type, unlike Client.Get
+func (h *HttpClient) Get(url string, headers http.Header) (*http.Response, error) {
+	return h.send(http.MethodGet, url, nil, headers)
+}
+
+// Post send POST request through Do, so the returned error keep its type, unlike Client.Post
+func (h *HttpClient) Post(url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return h.send(http.MethodPost, url, body, headers)
+}
+
+// Put send PUT request through Do, so the returned error keep its type, unlike Client.Put
+func (h *HttpClient) Put(url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return h.send(http.MethodPut, url, body, headers)
+}
+
+// Patch send PATCH request through Do, so the returned error keep its type, unlike Client.Patch
+func (h *HttpClient) Patch(url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return h.send(http.MethodPatch, url, body, headers)
+}
+
+// Delete send DELETE request through Do, so the returned error keep its type, unlike Client.Delete
+func (h *HttpClient) Delete(url string, headers http.Header) (*http.Response, error) {
+	return h.send(http.MethodDelete, url, nil, headers)
+}
+
+func (h *HttpClient) send(method, url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers != nil {
+		req.Header = headers
+	}
+
+	return h.Do(req)
+}
+
+// Close write the buffered latency points to influx. Call it on shutdown when Logging.Influx is set.
+func (h *HttpClient) Close() error {
+	if h.logging == nil {
+		return nil
+	}
+
+	return h.logging.Close()
+}
+
+// CircuitState returns the circuit breaker state of the host. It's always CircuitClosed when circuit breaker is disabled.
+func (h *HttpClient) CircuitState(host string) CircuitState {
+	if h.circuitBreaker == nil {
+		return CircuitClosed
+	}
+
+	return h.circuitBreaker.State(host)
+}
+
 func getDefaultHttpClientConf() *HttpClientConf {
 	conf := new(HttpClientConf)
 	conf.BackoffInterval = 2 * time.Millisecond       // 2ms
@@ -1,13 +1,29 @@
 package httpclient
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gojektech/heimdall"
 	"github.com/gojektech/heimdall/httpclient"
+	phttp "github.com/kitabisa/perkakas/v2/http"
+	"github.com/kitabisa/perkakas/v2/httputil"
+	"github.com/kitabisa/perkakas/v2/log"
+	"github.com/kitabisa/perkakas/v2/metrics/influx"
+	"github.com/kitabisa/perkakas/v2/middleware"
+	"github.com/kitabisa/perkakas/v2/signature"
+	"github.com/kitabisa/perkakas/v2/structs"
+	"github.com/kitabisa/perkakas/v2/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
@@ -104,3 +120,509 @@ func (suite *LogTestSuite) TestGetRequestWithCustomClient() {
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(LogTestSuite))
 }
+
+func (suite *LogTestSuite) TestRequestIDPropagation() {
+	defer gock.Off()
+
+	requestID := "3891967c-8589-42e0-a493-4fb6a0287992"
+	gock.New(suite.host).
+		Get(suite.endpoint).
+		MatchHeader(httputil.HeaderRequestID, requestID).
+		Reply(200).
+		JSON(suite.mockResponse)
+
+	ctx := httputil.ContextWithRequestID(context.Background(), requestID)
+	req, err := http.NewRequest(http.MethodGet, suite.url, nil)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+
+	_, err = suite.HttpClient.Do(req.WithContext(ctx))
+	assert.Nil(suite.T(), err, "Nil expected")
+	assert.Equal(suite.T(), true, gock.IsDone(), "Must be equal")
+	assert.Empty(suite.T(), req.Header.Get(httputil.HeaderRequestID), "request of the caller should not be changed")
+}
+
+func TestSignedRequest(t *testing.T) {
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	headerCheck := middleware.NewHeaderCheckWithConfig(hctx, middleware.HeaderCheckConfig{
+		SecretKey:            "secret",
+		ClockSkew:            time.Minute,
+		AllowLegacySignature: true,
+	})
+
+	ts := httptest.NewServer(headerCheck(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})))
+	defer ts.Close()
+
+	for _, version := range []string{"", signature.Version2} {
+		client := NewHttpClient(&HttpClientConf{
+			Timeout: time.Second,
+			Signer: &SignerConf{
+				ClientName:       "kitabisa-apps",
+				ClientVersion:    "1.0.0",
+				ApiVersion:       "1.0.0",
+				PlatformName:     "backend",
+				SecretKey:        "secret",
+				SignatureVersion: version,
+			},
+		})
+
+		resp, err := client.Client.Post(ts.URL+"/donations?b=2&a=1", strings.NewReader(`{"amount":10000}`), http.Header{})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.Equal(t, `{"amount":10000}`, string(body))
+	}
+}
+
+func TestSignedRequestRetryKeepsBody(t *testing.T) {
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	headerCheck := middleware.NewHeaderCheckWithConfig(hctx, middleware.HeaderCheckConfig{
+		SecretKey: "secret",
+		ClockSkew: time.Minute,
+	})
+
+	var calls int32
+	ts := httptest.NewServer(headerCheck(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})))
+	defer ts.Close()
+
+	signer := SignerConf{
+		ClientName:       "kitabisa-apps",
+		ClientVersion:    "1.0.0",
+		ApiVersion:       "1.0.0",
+		PlatformName:     "backend",
+		SecretKey:        "secret",
+		SignatureVersion: signature.Version2,
+	}
+
+	// heimdall retrier sends the same request again, so the signer must not consume its body
+	heimdallClient := httpclient.NewClient(
+		httpclient.WithHTTPTimeout(time.Second),
+		httpclient.WithRetryCount(1),
+		httpclient.WithRetrier(heimdall.NewRetrier(heimdall.NewConstantBackoff(time.Millisecond, time.Millisecond))),
+		httpclient.WithHTTPClient(NewSigningDoer(&http.Client{Timeout: time.Second}, signer)),
+	)
+
+	// retryDoer with POST allowed
+	client := NewHttpClient(&HttpClientConf{
+		Timeout:         time.Second,
+		RetryCount:      1,
+		BackoffInterval: time.Millisecond,
+		RetryMethods:    []string{http.MethodPost},
+		Signer:          &signer,
+	})
+
+	for _, c := range []heimdall.Client{heimdallClient, client.Client} {
+		atomic.StoreInt32(&calls, 0)
+
+		resp, err := c.Post(ts.URL+"/donations", strings.NewReader(`{"amount":10000}`), http.Header{})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.Equal(t, `{"amount":10000}`, string(body))
+	}
+}
+
+func TestSignRequestBody(t *testing.T) {
+	conf := SignerConf{
+		ClientName:       "kitabisa-apps",
+		ClientVersion:    "1.0.0",
+		SecretKey:        "secret",
+		SignatureVersion: signature.Version2,
+		MaxBodySize:      16,
+	}
+
+	expectedSignature := func(req *http.Request, body string) string {
+		canonicalRequest := signature.CanonicalRequest(req.Method, req.URL.EscapedPath(), req.URL.Query(), []byte(body))
+		data := signature.StringToSign(conf.ClientName, req.Header.Get("X-Ktbs-Time"), req.Header.Get("X-Ktbs-Nonce"), canonicalRequest)
+		return signature.GenerateHmac(data, conf.SecretKey)
+	}
+
+	// the body with GetBody is hashed while streaming, so it's not limited nor replaced
+	payload := strings.Repeat("a", 100)
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/donations", strings.NewReader(payload))
+	body := req.Body
+	assert.Nil(t, SignRequest(req, conf))
+	assert.Equal(t, expectedSignature(req, payload), req.Header.Get("X-Ktbs-Signature"))
+	assert.True(t, body == req.Body, "body should be sent as is")
+
+	// the body without GetBody is read into memory up to MaxBodySize
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/donations", nil)
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"amount":10000}`))
+	assert.Nil(t, SignRequest(req, conf))
+	assert.Equal(t, expectedSignature(req, `{"amount":10000}`), req.Header.Get("X-Ktbs-Signature"))
+
+	b, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"amount":10000}`, string(b), "body should be restored")
+
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/donations", nil)
+	req.Body = ioutil.NopCloser(strings.NewReader(payload))
+	assert.Equal(t, httputil.ErrBodyTooLarge, SignRequest(req, conf))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if call < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(&HttpClientConf{
+		BackoffInterval: time.Millisecond,
+		BackoffPolicy:   ExponentialBackoff,
+		Timeout:         time.Second,
+		RetryCount:      3,
+	})
+
+	resp, err := client.Client.Put(ts.URL, strings.NewReader("hello"), http.Header{})
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// POST is not idempotent, so it's not retried
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Client.Post(ts.URL, strings.NewReader("hello"), http.Header{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryBudget(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(&HttpClientConf{
+		BackoffInterval: time.Millisecond,
+		BackoffPolicy:   DecorrelatedJitterBackoff,
+		Timeout:         time.Second,
+		RetryCount:      3,
+		RetryBudget:     &RetryBudget{Ratio: 0.5},
+	})
+
+	for i := 0; i < 4; i++ {
+		resp, err := client.Client.Get(ts.URL, http.Header{})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+
+	// 4 requests with ratio 0.5 only allow 2 retries in total
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	_, ok := parseRetryAfter(resp)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "120")
+	wait, ok := parseRetryAfter(resp)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, wait)
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	wait, ok = parseRetryAfter(resp)
+	assert.True(t, ok)
+	assert.True(t, wait > 59*time.Minute)
+}
+
+func TestRetryAfterLimit(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", r.URL.Query().Get("retry_after"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(&HttpClientConf{
+		BackoffInterval:        time.Millisecond,
+		MaximumBackoffInterval: time.Second,
+		Timeout:                time.Second,
+		RetryCount:             3,
+	})
+
+	// Retry-After longer than MaximumBackoffInterval is not waited, the response is returned right away
+	start := time.Now()
+	resp, err := client.Client.Get(ts.URL+"?retry_after=86400", http.Header{})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.True(t, time.Since(start) < time.Second)
+
+	// the wait is interrupted when the request context is done
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"?retry_after=1", nil)
+	_, err = client.Do(req.WithContext(ctx))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls, healthy int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient(&HttpClientConf{
+		Timeout: time.Second,
+		CircuitBreaker: &CircuitBreakerConf{
+			FailureThreshold: 2,
+			OpenTimeout:      50 * time.Millisecond,
+		},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	host := req.URL.Host
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	}
+	assert.Equal(t, CircuitOpen, client.CircuitState(host))
+
+	// open circuit fail fast without calling the server
+	_, err := client.Do(req)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	var circuitErr *CircuitOpenError
+	assert.True(t, errors.As(err, &circuitErr))
+	assert.True(t, errors.Is(err, structs.ErrServiceUnavailable))
+
+	// Get & Post keep the error type too, unlike heimdall client
+	_, err = client.Get(ts.URL, nil)
+	assert.True(t, errors.As(err, &circuitErr))
+
+	_, err = client.Post(ts.URL, strings.NewReader(`{}`), http.Header{})
+	assert.True(t, errors.Is(err, structs.ErrServiceUnavailable))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	writer := phttp.CustomWriter{C: hctx}
+	rec := httptest.NewRecorder()
+	writer.WriteError(rec, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// half-open circuit is closed after success request
+	for i := 0; i < 100 && client.CircuitState(host) != CircuitHalfOpen; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, CircuitHalfOpen, client.CircuitState(host))
+
+	atomic.StoreInt32(&healthy, 1)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, CircuitClosed, client.CircuitState(host))
+}
+
+type person struct {
+	Name string `json:"name"`
+}
+
+func TestJSONHelpers(t *testing.T) {
+	hctx := phttp.NewContextHandler(structs.Meta{Version: "v1.0.0"})
+	errNotFound := &structs.ErrorResponse{
+		Response: structs.Response{
+			ResponseCode: "10001",
+			ResponseDesc: structs.ResponseDesc{ID: "Tidak ditemukan", EN: "Not found"},
+		},
+		HttpStatus: http.StatusNotFound,
+	}
+	hctx.AddError(errNotFound, errNotFound)
+
+	handler := phttp.NewHttpHandler(hctx)
+	mux := http.NewServeMux()
+	mux.Handle("/person", handler(func(w http.ResponseWriter, r *http.Request) (interface{}, *string, error) {
+		return person{Name: "Budi"}, nil, nil
+	}))
+	mux.Handle("/persons", handler(func(w http.ResponseWriter, r *http.Request) (interface{}, *string, error) {
+		var p person
+		json.NewDecoder(r.Body).Decode(&p)
+		next := "page-2"
+		return []person{p, {Name: "Badu"}}, &next, nil
+	}))
+	mux.Handle("/missing", handler(func(w http.ResponseWriter, r *http.Request) (interface{}, *string, error) {
+		return nil, nil, errNotFound
+	}))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := NewHttpClient(nil)
+	ctx := context.Background()
+
+	var p person
+	err := client.GetJSON(ctx, ts.URL+"/person", nil, &p)
+	assert.Nil(t, err)
+	assert.Equal(t, "Budi", p.Name)
+
+	var persons []person
+	err = client.PostJSON(ctx, ts.URL+"/persons", person{Name: "Ani"}, nil, &persons)
+	assert.Nil(t, err)
+	assert.Equal(t, []person{{Name: "Ani"}, {Name: "Badu"}}, persons)
+
+	err = client.GetJSON(ctx, ts.URL+"/missing", nil, &p)
+	var errResponse *structs.ErrorResponse
+	assert.True(t, errors.As(err, &errResponse))
+	assert.Equal(t, "10001", errResponse.ResponseCode)
+	assert.Equal(t, http.StatusNotFound, errResponse.HttpStatus)
+
+	err = client.GetJSON(ctx, ts.URL+"/not-registered", nil, &p)
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestLoggingDoer(t *testing.T) {
+	var calls int32
+	var mu sync.Mutex
+	var points []string
+	influxServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		points = append(points, strings.Split(strings.TrimSpace(string(b)), "\n")...)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxServer.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Write([]byte(`{"test":"a1234-abcd"}`))
+	}))
+	defer ts.Close()
+
+	influxClient, err := influx.NewClient(influx.ClientConfig{Addr: influxServer.URL, Database: "test"})
+	if err != nil {
+		t.FailNow()
+	}
+
+	client := NewHttpClient(&HttpClientConf{
+		BackoffInterval: time.Millisecond,
+		Timeout:         time.Second,
+		RetryCount:      1,
+		Logging: &LoggingConf{
+			Logger: log.NewLogger("test"),
+			Influx: influxClient,
+		},
+	})
+
+	resp, err := client.Client.Get(ts.URL+"/test", http.Header{"Authorization": []string{"Bearer token"}})
+	assert.Nil(t, err)
+
+	// response body can still be read after logged
+	result := &httpClientResponse{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	assert.Nil(t, err)
+	assert.Equal(t, "a1234-abcd", result.Test)
+
+	// close write the buffered points of both attempts
+	assert.Nil(t, client.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, points, 2)
+}
+
+func TestTracingPropagation(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer("test", tracing.WithSyncer(exporter))
+
+	var traceState atomic.Value
+	handler := middleware.NewTracing(tracer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceState.Store(r.Header.Get(tracing.HeaderTraceState))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewHttpClient(&HttpClientConf{
+		BackoffInterval: time.Millisecond,
+		Timeout:         time.Second,
+		RetryCount:      1,
+		Tracer:          tracer,
+	})
+
+	// the incoming request of the caller carries tracestate
+	incoming := http.Header{}
+	incoming.Set(tracing.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set(tracing.HeaderTraceState, "congo=t61rcWkgMzE")
+
+	ctx, root := tracer.Start(tracing.Extract(context.Background(), incoming), "create donation")
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/campaigns", nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	root.End()
+
+	assert.Empty(t, req.Header.Get(tracing.HeaderTraceParent), "request of the caller should not be changed")
+
+	assert.Equal(t, "congo=t61rcWkgMzE", traceState.Load(), "tracestate should be forwarded to the next hop")
+
+	// server and client span of each attempt, then the root span
+	spans := exporter.Spans()
+	if !assert.Len(t, spans, 5) {
+		t.FailNow()
+	}
+
+	for i := 0; i < 4; i += 2 {
+		server, client := spans[i], spans[i+1]
+		assert.Equal(t, tracing.SpanKindServer, server.Kind)
+		assert.Equal(t, tracing.SpanKindClient, client.Kind)
+		assert.Equal(t, client.SpanID, server.ParentSpanID, "server span should be the child of client span")
+		assert.Equal(t, root.SpanContext().SpanID.String(), client.ParentSpanID)
+		assert.Equal(t, root.SpanContext().TraceID.String(), server.TraceID)
+		assert.Equal(t, i/2, client.Attributes[FieldAttempt])
+		assert.Equal(t, tracing.StatusError, server.StatusCode)
+	}
+}
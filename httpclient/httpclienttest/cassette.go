@@ -0,0 +1,210 @@
+package httpclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+// Mode is the mode of the cassette recorder
+type Mode int
+
+const (
+	// ModeReplay replay the saved interactions and never send the real request
+	ModeReplay Mode = iota
+
+	// ModeRecord send the real request and record the interaction
+	ModeRecord
+
+	// ModeReplayOrRecord replay when the cassette file exists, otherwise record
+	ModeReplayOrRecord
+)
+
+// Interaction is a recorded request & response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Recorder is a heimdall.Doer that record real exchanges to a cassette file and replay them
+type Recorder struct {
+	path         string
+	mode         Mode
+	doer         heimdall.Doer
+	interactions []Interaction
+	used         map[int]bool
+	redactor     *httputil.Redactor
+	mutex        sync.Mutex
+}
+
+// NewRecorder create cassette recorder. On replay mode the cassette file at path is loaded,
+// on record mode the request is sent with doer. Call Save to write recorded interactions to the file.
+func NewRecorder(path string, mode Mode, doer heimdall.Doer) (r *Recorder, err error) {
+	if mode == ModeReplayOrRecord {
+		mode = ModeRecord
+		if _, statErr := os.Stat(path); statErr == nil {
+			mode = ModeReplay
+		}
+	}
+
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+
+	r = &Recorder{
+		path:     path,
+		mode:     mode,
+		doer:     doer,
+		used:     make(map[int]bool),
+		redactor: httputil.DefaultRedactor,
+	}
+
+	if mode == ModeReplay {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(b, &r.interactions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// SetRedactor set the redactor of the headers and bodies saved to the cassette file. Default is httputil.DefaultRedactor.
+// Nil redactor is ignored.
+func (r *Recorder) SetRedactor(redactor *httputil.Redactor) {
+	if redactor == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.redactor = redactor
+}
+
+// Mode returns the mode of the recorder
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		body = httputil.ReadRequestBody(req)
+	}
+
+	// the cassette file has the redacted body, so the live body is matched after redacted the same way
+	r.mutex.Lock()
+	body = r.redactor.Body(body, req.Header.Get("Content-Type"))
+	r.mutex.Unlock()
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+
+	return r.record(req, body)
+}
+
+// Save write the recorded interactions to the cassette file
+func (r *Recorder) Save() (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.mode != ModeRecord {
+		return
+	}
+
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(r.path, b, 0644)
+}
+
+func (r *Recorder) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := r.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	// the cassette file is committed to git, so the secrets in the headers and bodies are redacted
+	r.mutex.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.redactor.Header(httputil.ExcludeSensitiveHeader(req.Header)),
+			Body:   body,
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactor.Header(resp.Header),
+			Body:       r.redactor.Body(string(respBody), resp.Header.Get("Content-Type")),
+		},
+	})
+	r.mutex.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the first unused interaction with the same method, url and body
+func (r *Recorder) replay(req *http.Request, body string) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] {
+			continue
+		}
+
+		recorded := interaction.Request
+		if recorded.Method != req.Method || recorded.URL != req.URL.String() || recorded.Body != body {
+			continue
+		}
+
+		r.used[i] = true
+		res := interaction.Response
+		return newResponse(req, res.StatusCode, res.Header, []byte(res.Body)), nil
+	}
+
+	return nil, fmt.Errorf("httpclienttest: no recorded interaction for %s %s", req.Method, req.URL.String())
+}
@@ -0,0 +1,278 @@
+// Package httpclienttest provides heimdall.Doer stub and cassette recorder for testing code that use httpclient.HttpClient
+package httpclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestingT is the subset of testing.T used by the stub
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Response is a scripted response. When Err is not nil, it is returned instead of the response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Err        error
+	Latency    time.Duration
+}
+
+// Expectation is the expected request and its scripted responses
+type Expectation struct {
+	method    string
+	url       string
+	header    http.Header
+	times     int
+	responses []Response
+	calls     int
+}
+
+// Doer is a scriptable heimdall.Doer. It's safe to use in parallel tests, since each test has its own Doer.
+type Doer struct {
+	expectations []*Expectation
+	requests     []*http.Request
+	mutex        sync.Mutex
+}
+
+// NewDoer create a Doer without any expectation. Use it with httpclient.NewHttpWithCustomClient.
+func NewDoer() *Doer {
+	return &Doer{}
+}
+
+// Expect add expectation of request with method and url. url can be the full url or only the path.
+// When url has no query, the query of the request is not checked.
+func (d *Doer) Expect(method, url string) *Expectation {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	e := &Expectation{
+		method: method,
+		url:    url,
+		header: make(http.Header),
+	}
+
+	d.expectations = append(d.expectations, e)
+	return e
+}
+
+// WithHeader expect the request to have header key with value
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// Times limit the expectation to match n requests. Zero means unlimited.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Respond add response to the sequence. The responses are returned in order, and the last one is repeated.
+func (e *Expectation) Respond(statusCode int, body string) *Expectation {
+	e.responses = append(e.responses, Response{
+		StatusCode: statusCode,
+		Header:     make(http.Header),
+		Body:       []byte(body),
+	})
+	return e
+}
+
+// RespondJSON add json response to the sequence
+func (e *Expectation) RespondJSON(statusCode int, v interface{}) *Expectation {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("httpclienttest: failed to marshal response: %s", err))
+	}
+
+	e.Respond(statusCode, string(b))
+	e.responses[len(e.responses)-1].Header.Set("Content-Type", "application/json")
+	return e
+}
+
+// RespondError add error to the sequence, e.g. to simulate connection refused
+func (e *Expectation) RespondError(err error) *Expectation {
+	e.responses = append(e.responses, Response{Err: err})
+	return e
+}
+
+// WithResponseHeader set header of the last added response
+func (e *Expectation) WithResponseHeader(key, value string) *Expectation {
+	last := &e.responses[len(e.responses)-1]
+	if last.Header == nil {
+		last.Header = make(http.Header)
+	}
+
+	last.Header.Set(key, value)
+	return e
+}
+
+// Delay set latency of the last added response
+func (e *Expectation) Delay(latency time.Duration) *Expectation {
+	e.responses[len(e.responses)-1].Latency = latency
+	return e
+}
+
+func (e *Expectation) match(req *http.Request) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+
+	if !strings.EqualFold(e.method, req.Method) || !matchURL(e.url, req.URL) {
+		return false
+	}
+
+	for k, values := range e.header {
+		for _, v := range values {
+			if !containsValue(req.Header[http.CanonicalHeaderKey(k)], v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (e *Expectation) next() Response {
+	i := e.calls
+	if i >= len(e.responses) {
+		i = len(e.responses) - 1
+	}
+
+	e.calls++
+	if i < 0 {
+		return Response{StatusCode: http.StatusOK}
+	}
+
+	return e.responses[i]
+}
+
+// Do return the next scripted response of the first matching expectation
+func (d *Doer) Do(req *http.Request) (*http.Response, error) {
+	d.mutex.Lock()
+	d.requests = append(d.requests, req)
+
+	var expectation *Expectation
+	for _, e := range d.expectations {
+		if e.match(req) {
+			expectation = e
+			break
+		}
+	}
+
+	if expectation == nil {
+		d.mutex.Unlock()
+		return nil, fmt.Errorf("httpclienttest: no expectation for %s %s", req.Method, req.URL.String())
+	}
+
+	res := expectation.next()
+	d.mutex.Unlock()
+
+	if res.Latency > 0 {
+		timer := time.NewTimer(res.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	return newResponse(req, res.StatusCode, res.Header, res.Body), nil
+}
+
+// Requests returns the requests received by the doer
+func (d *Doer) Requests() []*http.Request {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return append([]*http.Request{}, d.requests...)
+}
+
+// AssertExpectations check that every expectation is called, and called n times when Times(n) is set
+func (d *Doer) AssertExpectations(t TestingT) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ok := true
+	for _, e := range d.expectations {
+		if e.calls == 0 || (e.times > 0 && e.calls != e.times) {
+			t.Errorf("httpclienttest: expected %s %s to be called %d times, but called %d times", e.method, e.url, e.times, e.calls)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func newResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func matchURL(expected string, actual *url.URL) bool {
+	u, err := url.Parse(expected)
+	if err != nil {
+		return false
+	}
+
+	if u.Host != "" && (u.Host != actual.Host || (u.Scheme != "" && u.Scheme != actual.Scheme)) {
+		return false
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	actualPath := actual.Path
+	if actualPath == "" {
+		actualPath = "/"
+	}
+
+	if path != actualPath {
+		return false
+	}
+
+	if u.RawQuery != "" && u.Query().Encode() != actual.Query().Encode() {
+		return false
+	}
+
+	return true
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
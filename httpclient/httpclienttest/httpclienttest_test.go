@@ -0,0 +1,134 @@
+package httpclienttest_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kitabisa/perkakas/v2/httpclient"
+	"github.com/kitabisa/perkakas/v2/httpclient/httpclienttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoerSequentialResponses(t *testing.T) {
+	t.Parallel()
+
+	doer := httpclienttest.NewDoer()
+	doer.Expect(http.MethodGet, "http://campaign-service/campaigns").
+		WithHeader("X-Ktbs-Client-Name", "donation-service").
+		Respond(http.StatusServiceUnavailable, "").
+		RespondJSON(http.StatusOK, map[string]string{"id": "1"})
+
+	client := httpclient.NewHttpWithCustomClient(&httpclient.HttpClientConf{
+		BackoffInterval: time.Millisecond,
+		RetryCount:      1,
+	}, doer)
+
+	header := http.Header{"X-Ktbs-Client-Name": []string{"donation-service"}}
+	resp, err := client.Client.Get("http://campaign-service/campaigns?page=1", header)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"id":"1"}`, string(body))
+	assert.Len(t, doer.Requests(), 2)
+	assert.True(t, doer.AssertExpectations(t))
+}
+
+func TestDoerErrorAndLatency(t *testing.T) {
+	t.Parallel()
+
+	errRefused := errors.New("connection refused")
+	doer := httpclienttest.NewDoer()
+	doer.Expect(http.MethodPost, "/donations").RespondError(errRefused)
+	doer.Expect(http.MethodGet, "/slow").Respond(http.StatusOK, "").Delay(time.Second)
+
+	client := httpclient.NewHttpWithCustomClient(nil, doer)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://donation-service/donations", nil)
+	_, err := client.Do(req)
+	assert.Equal(t, errRefused, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, _ = http.NewRequest(http.MethodGet, "http://donation-service/slow", nil)
+	_, err = client.Do(req.WithContext(ctx))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	_, err = client.Do(httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.NotNil(t, err)
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "session-secret"})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"token-secret","name":"budi"}`))
+			return
+		}
+
+		w.Write([]byte("hello " + r.URL.Query().Get("name")))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	cassette := filepath.Join(dir, "hello.json")
+
+	recorder, err := httpclienttest.NewRecorder(cassette, httpclienttest.ModeReplayOrRecord, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, httpclienttest.ModeRecord, recorder.Mode())
+
+	client := httpclient.NewHttpWithCustomClient(nil, recorder)
+	resp, err := client.Client.Get(ts.URL+"?name=budi", http.Header{"Authorization": []string{"Bearer secret"}})
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	login := `{"username":"budi","password":"password-secret"}`
+	resp, err = client.Client.Post(ts.URL+"/login", strings.NewReader(login), http.Header{"Content-Type": []string{"application/json"}})
+	assert.Nil(t, err)
+
+	// the caller still gets the real response
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "token-secret")
+	assert.Nil(t, recorder.Save())
+
+	b, _ := ioutil.ReadFile(cassette)
+	for _, secret := range []string{"Bearer secret", "password-secret", "session-secret", "token-secret"} {
+		assert.NotContains(t, string(b), secret)
+	}
+
+	// replay without the server
+	ts.Close()
+	recorder, err = httpclienttest.NewRecorder(cassette, httpclienttest.ModeReplayOrRecord, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, httpclienttest.ModeReplay, recorder.Mode())
+
+	client = httpclient.NewHttpWithCustomClient(nil, recorder)
+	resp, err = client.Client.Get(ts.URL+"?name=budi", nil)
+	assert.Nil(t, err)
+
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "hello budi", string(body))
+
+	// the request body is matched after redacted
+	resp, err = client.Client.Post(ts.URL+"/login", strings.NewReader(login), http.Header{"Content-Type": []string{"application/json"}})
+	assert.Nil(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"access_token":"***","name":"budi"}`, string(body))
+}
@@ -0,0 +1,160 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/kitabisa/perkakas/v2/structs"
+)
+
+const successResponseCode = "000000"
+
+// StatusError is returned by the JSON helpers when the response is not success and the body is not perkakas envelope
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("httpclient: unexpected status code %d: %s", e.StatusCode, string(e.Body))
+}
+
+type envelope struct {
+	structs.Response
+	Next *string         `json:"next,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// GetJSON send GET request and decode the data of perkakas response envelope into out
+func (h *HttpClient) GetJSON(ctx context.Context, url string, headers http.Header, out interface{}) (err error) {
+	return h.sendJSON(ctx, http.MethodGet, url, nil, headers, out)
+}
+
+// PostJSON send body as json with POST request and decode the data of perkakas response envelope into out
+func (h *HttpClient) PostJSON(ctx context.Context, url string, body interface{}, headers http.Header, out interface{}) (err error) {
+	return h.sendJSON(ctx, http.MethodPost, url, body, headers, out)
+}
+
+// PutJSON send body as json with PUT request and decode the data of perkakas response envelope into out
+func (h *HttpClient) PutJSON(ctx context.Context, url string, body interface{}, headers http.Header, out interface{}) (err error) {
+	return h.sendJSON(ctx, http.MethodPut, url, body, headers, out)
+}
+
+// PatchJSON send body as json with PATCH request and decode the data of perkakas response envelope into out
+func (h *HttpClient) PatchJSON(ctx context.Context, url string, body interface{}, headers http.Header, out interface{}) (err error) {
+	return h.sendJSON(ctx, http.MethodPatch, url, body, headers, out)
+}
+
+// DeleteJSON send DELETE request and decode the data of perkakas response envelope into out
+func (h *HttpClient) DeleteJSON(ctx context.Context, url string, headers http.Header, out interface{}) (err error) {
+	return h.sendJSON(ctx, http.MethodDelete, url, nil, headers, out)
+}
+
+// DoJSON send req and decode the data of perkakas response envelope into out. It returns the next page token of the response.
+// Response with response_code other than 000000 is returned as *structs.ErrorResponse.
+func (h *HttpClient) DoJSON(req *http.Request, out interface{}) (next *string, err error) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := h.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	var env envelope
+	if jsonErr := json.Unmarshal(b, &env); jsonErr != nil || env.ResponseCode == "" {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &StatusError{StatusCode: resp.StatusCode, Body: b}
+		}
+
+		if jsonErr != nil {
+			return nil, jsonErr
+		}
+	}
+
+	if env.ResponseCode != "" && env.ResponseCode != successResponseCode {
+		return nil, &structs.ErrorResponse{
+			Response:   env.Response,
+			HttpStatus: resp.StatusCode,
+		}
+	}
+
+	next = env.Next
+	err = decodeData(env.Data, out)
+	return
+}
+
+func (h *HttpClient) sendJSON(ctx context.Context, method, url string, body interface{}, headers http.Header, out interface{}) (err error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return
+	}
+
+	req.Header = make(http.Header)
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	_, err = h.DoJSON(req.WithContext(ctx), out)
+	return
+}
+
+// decodeData decode data into out. Since phttp.CustomWriter always write non slice data as array of one element,
+// the first element is decoded when out is not a slice.
+func decodeData(data json.RawMessage, out interface{}) (err error) {
+	if out == nil || len(data) == 0 {
+		return
+	}
+
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return fmt.Errorf("httpclient: out must be a non nil pointer, got %T", out)
+	}
+
+	switch outValue.Elem().Kind() {
+	case reflect.Slice, reflect.Array, reflect.Interface:
+		return json.Unmarshal(data, out)
+	}
+
+	var items []json.RawMessage
+	if json.Unmarshal(data, &items) != nil {
+		return json.Unmarshal(data, out)
+	}
+
+	if len(items) == 0 {
+		return
+	}
+
+	return json.Unmarshal(items[0], out)
+}
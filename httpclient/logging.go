@@ -0,0 +1,154 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/httputil"
+	"github.com/kitabisa/perkakas/v2/log"
+	"github.com/kitabisa/perkakas/v2/metrics/influx"
+)
+
+const (
+	FieldAttempt = "attempt"
+
+	defaultMeasurementName = "http_client"
+)
+
+// LoggingConf is the configuration for logging outbound request & response
+type LoggingConf struct {
+	// Logger is the parent logger. Each request is logged with its child logger.
+	Logger *log.Logger
+
+	// Influx export the latency to influx when it's not nil
+	Influx *influx.Client
+
+	// MeasurementName is the influx measurement name. Default is http_client.
+	MeasurementName string
+
+	// MetricsBufferSize is the number of points buffered before written to influx in batch. When the buffer is full,
+	// the point is dropped. Default is 1024.
+	MetricsBufferSize int
+
+	// MetricsFlushInterval is the interval of writing the buffered points. Default is 1 second.
+	MetricsFlushInterval time.Duration
+
+	// MaxBodySize is the maximum response body size captured for logging. Default is httputil.DefaultMaxLogBodySize.
+	MaxBodySize int64
+}
+
+// LoggingDoer log every request & response, and export the latency to influx
+type LoggingDoer struct {
+	doer    heimdall.Doer
+	conf    LoggingConf
+	metrics *metricsWriter
+}
+
+// NewLoggingDoer wrap doer to log every request & response, and export the latency to influx.
+// Call Close on shutdown to write the buffered points.
+func NewLoggingDoer(doer heimdall.Doer, conf LoggingConf) *LoggingDoer {
+	if conf.MeasurementName == "" {
+		conf.MeasurementName = defaultMeasurementName
+	}
+
+	d := &LoggingDoer{
+		doer: doer,
+		conf: conf,
+	}
+
+	if conf.Influx != nil {
+		d.metrics = newMetricsWriter(conf)
+	}
+
+	return d
+}
+
+// Close write the buffered points to influx
+func (d *LoggingDoer) Close() error {
+	if d.metrics == nil {
+		return nil
+	}
+
+	return d.metrics.Close()
+}
+
+// DroppedPoints returns the number of latency points dropped because the buffer is full
+func (d *LoggingDoer) DroppedPoints() int64 {
+	if d.metrics == nil {
+		return 0
+	}
+
+	return d.metrics.droppedPoints()
+}
+
+func (d *LoggingDoer) Do(req *http.Request) (*http.Response, error) {
+	attempt := AttemptFromContext(req.Context())
+
+	var logger *log.Logger
+	if d.conf.Logger != nil {
+		logger = d.conf.Logger.NewChildLogger()
+		logger.SetRequest(req)
+		logger.SetField(FieldAttempt, attempt)
+	}
+
+	start := time.Now()
+	resp, err := d.doer.Do(req)
+	latency := time.Since(start)
+
+	if logger != nil {
+		d.log(logger, req, resp, err, latency)
+	}
+
+	if d.metrics != nil {
+		d.writeMetrics(req, resp, err, latency, attempt)
+	}
+
+	return resp, err
+}
+
+func (d *LoggingDoer) log(logger *log.Logger, req *http.Request, resp *http.Response, err error, latency time.Duration) {
+	logger.SetField(log.FieldLatency, float64(latency)/float64(time.Millisecond))
+
+	if err != nil {
+		logger.AddMessage(log.ErrorLevel, fmt.Sprintf("%s %s failed: %s", req.Method, req.URL.String(), err.Error()))
+		logger.Print()
+		return
+	}
+
+	body := httputil.ReadResponseBodyLimit(resp, d.conf.MaxBodySize)
+	logger.SetResponse(resp, []byte(body))
+
+	level := log.InfoLevel
+	if resp.StatusCode >= http.StatusInternalServerError {
+		level = log.ErrorLevel
+	} else if resp.StatusCode >= http.StatusBadRequest {
+		level = log.WarnLevel
+	}
+
+	logger.AddMessage(level, fmt.Sprintf("%s %s %d", req.Method, req.URL.String(), resp.StatusCode))
+	logger.Print()
+}
+
+func (d *LoggingDoer) writeMetrics(req *http.Request, resp *http.Response, err error, latency time.Duration, attempt int) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+
+	tags := influx.Tags{
+		"method": req.Method,
+		"host":   req.URL.Host,
+		"status": status,
+	}
+
+	fields := influx.Fields{
+		"latency_ms": float64(latency) / float64(time.Millisecond),
+		"attempt":    attempt,
+		"path":       req.URL.Path,
+	}
+
+	d.metrics.add(tags, fields)
+}
@@ -0,0 +1,142 @@
+package httpclient
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kitabisa/perkakas/v2/metrics/influx"
+)
+
+const (
+	defaultMetricsBufferSize    = 1024
+	defaultMetricsBatchSize     = 100
+	defaultMetricsFlushInterval = time.Second
+)
+
+type metricsPoint struct {
+	tags   influx.Tags
+	fields influx.Fields
+	time   time.Time
+}
+
+// metricsWriter buffer the points in bounded channel, and write them to influx in batch from single goroutine.
+// When the buffer is full, the point is dropped, so influx never slows down the request.
+type metricsWriter struct {
+	influx        *influx.Client
+	measurement   string
+	batchSize     int
+	flushInterval time.Duration
+
+	points  chan metricsPoint
+	dropped int64
+
+	stop   chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+func newMetricsWriter(conf LoggingConf) *metricsWriter {
+	if conf.MetricsBufferSize <= 0 {
+		conf.MetricsBufferSize = defaultMetricsBufferSize
+	}
+
+	if conf.MetricsFlushInterval <= 0 {
+		conf.MetricsFlushInterval = defaultMetricsFlushInterval
+	}
+
+	w := &metricsWriter{
+		influx:        conf.Influx,
+		measurement:   conf.MeasurementName,
+		batchSize:     defaultMetricsBatchSize,
+		flushInterval: conf.MetricsFlushInterval,
+		points:        make(chan metricsPoint, conf.MetricsBufferSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// add buffer the point, or drop it when the buffer is full
+func (w *metricsWriter) add(tags influx.Tags, fields influx.Fields) {
+	select {
+	case <-w.stop:
+		atomic.AddInt64(&w.dropped, 1)
+		return
+	default:
+	}
+
+	select {
+	case w.points <- metricsPoint{tags: tags, fields: fields, time: time.Now()}:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+func (w *metricsWriter) droppedPoints() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Close write the buffered points, then stop the writer goroutine
+func (w *metricsWriter) Close() error {
+	w.closed.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+
+	return nil
+}
+
+func (w *metricsWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]metricsPoint, 0, w.batchSize)
+	for {
+		select {
+		case point := <-w.points:
+			batch = append(batch, point)
+			if len(batch) >= w.batchSize {
+				batch = w.write(batch)
+			}
+		case <-ticker.C:
+			batch = w.write(batch)
+		case <-w.stop:
+			// drain the buffer before stopping
+			for {
+				select {
+				case point := <-w.points:
+					batch = append(batch, point)
+					if len(batch) >= w.batchSize {
+						batch = w.write(batch)
+					}
+				default:
+					w.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write write the batch to influx, then returns the batch emptied for reuse
+func (w *metricsWriter) write(batch []metricsPoint) []metricsPoint {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	writer, err := w.influx.NewBatchPointsWriter("ms")
+	if err == nil {
+		for _, point := range batch {
+			writer.AddPointsWithTime(w.measurement, point.tags, point.fields, point.time)
+		}
+
+		writer.Write()
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,33 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+// requestIDDoer send the request id stored in the request context as X-Ktbs-Request-ID header,
+// unless the header already set by the caller
+type requestIDDoer struct {
+	doer heimdall.Doer
+}
+
+func newRequestIDDoer(doer heimdall.Doer) heimdall.Doer {
+	return &requestIDDoer{doer: doer}
+}
+
+func (d *requestIDDoer) Do(req *http.Request) (*http.Response, error) {
+	requestID := httputil.RequestIDFromContext(req.Context())
+	if requestID != "" && req.Header.Get(httputil.HeaderRequestID) == "" {
+		// the caller may reuse req, so the header is set on the copy
+		req = req.Clone(req.Context())
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+
+		req.Header.Set(httputil.HeaderRequestID, requestID)
+	}
+
+	return d.doer.Do(req)
+}
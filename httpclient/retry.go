@@ -0,0 +1,261 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gojektech/heimdall"
+)
+
+var (
+	// DefaultRetryMethods is the idempotent methods that are retried when HttpClientConf.RetryMethods is empty
+	DefaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+
+	// DefaultRetryStatusCodes is the status codes that are retried when HttpClientConf.RetryStatusCodes is empty
+	DefaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+)
+
+// RetryBudget limit the number of retries relative to the number of requests,
+// so retries can not amplify the load when the downstream service is down
+type RetryBudget struct {
+	// Ratio is the maximum retries per request, e.g. 0.2 allows 1 retry for every 5 requests
+	Ratio float64
+
+	// MinRetriesPerSecond is the retries that always allowed, so low traffic client still can retry
+	MinRetriesPerSecond int
+
+	// Window is the duration where the requests and retries are counted. Default is 10 seconds.
+	Window time.Duration
+}
+
+type retryBudget struct {
+	conf    RetryBudget
+	buckets []budgetBucket
+	mutex   sync.Mutex
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+func newRetryBudget(conf RetryBudget) *retryBudget {
+	if conf.Window < time.Second {
+		conf.Window = 10 * time.Second
+	}
+
+	return &retryBudget{
+		conf:    conf,
+		buckets: make([]budgetBucket, int(conf.Window/time.Second)),
+	}
+}
+
+func (b *retryBudget) bucket(now time.Time) *budgetBucket {
+	second := now.Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+
+	return bucket
+}
+
+func (b *retryBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.bucket(time.Now()).requests++
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	minSecond := now.Unix() - int64(len(b.buckets))
+
+	requests, retries := 0, 0
+	for _, bucket := range b.buckets {
+		if bucket.second > minSecond {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	allowed := float64(b.conf.MinRetriesPerSecond*len(b.buckets)) + b.conf.Ratio*float64(requests)
+	if float64(retries) >= allowed {
+		return false
+	}
+
+	b.bucket(now).retries++
+	return true
+}
+
+type attemptKey struct{}
+
+func contextWithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the retry attempt number of the outbound request, 0 for the first attempt
+func AttemptFromContext(ctx context.Context) (attempt int) {
+	attempt, _ = ctx.Value(attemptKey{}).(int)
+	return
+}
+
+// retryDoer retry the request based on the method, status code, backoff policy and retry budget
+type retryDoer struct {
+	doer        heimdall.Doer
+	retryCount  int
+	backoff     backoff
+	methods     map[string]bool
+	statusCodes map[int]bool
+	budget      *retryBudget
+	maxWait     time.Duration
+}
+
+func newRetryDoer(doer heimdall.Doer, conf *HttpClientConf) heimdall.Doer {
+	methods := conf.RetryMethods
+	if len(methods) == 0 {
+		methods = DefaultRetryMethods
+	}
+
+	statusCodes := conf.RetryStatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = DefaultRetryStatusCodes
+	}
+
+	d := &retryDoer{
+		doer:        doer,
+		retryCount:  conf.RetryCount,
+		backoff:     newBackoff(conf),
+		methods:     make(map[string]bool),
+		statusCodes: make(map[int]bool),
+		maxWait:     conf.MaximumBackoffInterval,
+	}
+
+	if d.maxWait <= 0 {
+		d.maxWait = defaultMaximumBackoffInterval
+	}
+
+	for _, m := range methods {
+		d.methods[m] = true
+	}
+
+	for _, c := range statusCodes {
+		d.statusCodes[c] = true
+	}
+
+	if conf.RetryBudget != nil {
+		d.budget = newRetryBudget(*conf.RetryBudget)
+	}
+
+	return d
+}
+
+func (d *retryDoer) Do(req *http.Request) (resp *http.Response, err error) {
+	if d.budget != nil {
+		d.budget.deposit()
+	}
+
+	if d.retryCount <= 0 || !d.methods[req.Method] {
+		return d.doer.Do(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	var wait time.Duration
+	for retry := 0; ; retry++ {
+		attemptReq := req.WithContext(contextWithAttempt(req.Context(), retry))
+		if req.Body != nil {
+			attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err = d.doer.Do(attemptReq)
+		if retry >= d.retryCount || !d.shouldRetry(resp, err) {
+			return
+		}
+
+		retryAfter, ok := parseRetryAfter(resp)
+		if ok && retryAfter > d.maxWait {
+			// the server asks to come back later than we are willing to wait, return its response instead
+			return
+		}
+
+		if d.budget != nil && !d.budget.withdraw() {
+			return
+		}
+
+		if ok {
+			wait = retryAfter
+		} else {
+			wait = d.backoff.next(retry+1, wait)
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (d *retryDoer) shouldRetry(resp *http.Response, err error) bool {
+	if _, ok := err.(*CircuitOpenError); ok {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return d.statusCodes[resp.StatusCode]
+}
+
+// parseRetryAfter parse Retry-After header, either in seconds or http date
+func parseRetryAfter(resp *http.Response) (wait time.Duration, ok bool) {
+	if resp == nil {
+		return
+	}
+
+	retryAfter := resp.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		wait = time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	return
+}
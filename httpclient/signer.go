@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/httputil"
+	"github.com/kitabisa/perkakas/v2/random"
+	"github.com/kitabisa/perkakas/v2/signature"
+)
+
+// SignerConf is the configuration for signing outbound request, matching what middleware.NewHeaderCheck verifies
+type SignerConf struct {
+	ClientName    string
+	ClientVersion string
+	ApiVersion    string
+	PlatformName  string
+	SecretKey     string
+
+	// SignatureVersion is the signature scheme. Empty string for legacy ClientName+Time signature,
+	// or signature.Version2 for signing the canonical request.
+	SignatureVersion string
+
+	// MaxBodySize is the maximum body read into memory for signature version 2, when the body can't be read again
+	// through req.GetBody. The body with GetBody is hashed while streaming instead. Default is
+	// httputil.DefaultMaxSignedBodySize.
+	MaxBodySize int64
+}
+
+type signingDoer struct {
+	doer heimdall.Doer
+	conf SignerConf
+}
+
+// NewSigningDoer wrap doer to stamp the kitabisa header and X-Ktbs-Signature to every request
+func NewSigningDoer(doer heimdall.Doer, conf SignerConf) heimdall.Doer {
+	return &signingDoer{
+		doer: doer,
+		conf: conf,
+	}
+}
+
+func (d *signingDoer) Do(req *http.Request) (*http.Response, error) {
+	// the retrier may send req again and rewind its body, e.g. heimdall client, so the body read for signing
+	// is replaced on the copy sent for this attempt, and req.Body stays readable for the next attempt
+	signed := req.Clone(req.Context())
+	err := SignRequest(signed, d.conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.doer.Do(signed)
+}
+
+// SignRequest stamp the kitabisa header and X-Ktbs-Signature to req
+func SignRequest(req *http.Request, conf SignerConf) (err error) {
+	requestID := ""
+	if req.Header != nil {
+		requestID = req.Header.Get(httputil.HeaderRequestID)
+	}
+
+	httputil.KitabisaHeader(req, conf.ClientName, conf.ClientVersion, requestID)
+
+	if conf.ApiVersion != "" {
+		req.Header.Set("X-Ktbs-Api-Version", conf.ApiVersion)
+	}
+
+	if conf.PlatformName != "" {
+		req.Header.Set("X-Ktbs-Platform-Name", conf.PlatformName)
+	}
+
+	timestamp := req.Header.Get("X-Ktbs-Time")
+
+	switch conf.SignatureVersion {
+	case "":
+		data := fmt.Sprintf("%s%s", conf.ClientName, timestamp)
+		req.Header.Set("X-Ktbs-Signature", signature.GenerateHmac(data, conf.SecretKey))
+	case signature.Version2:
+		nonce, err := random.UUID()
+		if err != nil {
+			return err
+		}
+
+		bodyHash, err := hashBody(req, conf.MaxBodySize)
+		if err != nil {
+			return err
+		}
+
+		canonicalRequest := signature.CanonicalRequestWithBodyHash(req.Method, req.URL.EscapedPath(), req.URL.Query(), bodyHash)
+		data := signature.StringToSign(conf.ClientName, timestamp, nonce, canonicalRequest)
+
+		req.Header.Set("X-Ktbs-Nonce", nonce)
+		req.Header.Set("X-Ktbs-Signature-Version", signature.Version2)
+		req.Header.Set("X-Ktbs-Signature", signature.GenerateHmac(data, conf.SecretKey))
+	default:
+		return fmt.Errorf("httpclient: unknown signature version %s", conf.SignatureVersion)
+	}
+
+	return
+}
+
+// hashBody returns sha256 of the request body. The body from req.GetBody, e.g. set by http.NewRequest, is hashed
+// while streaming, so req.Body is sent as is. Otherwise the body is read into memory up to maxBodySize and restored.
+func hashBody(req *http.Request, maxBodySize int64) ([]byte, error) {
+	h := sha256.New()
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return h.Sum(nil), nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+
+		if _, err = io.Copy(h, body); err != nil {
+			return nil, err
+		}
+
+		return h.Sum(nil), nil
+	}
+
+	if maxBodySize <= 0 {
+		maxBodySize = httputil.DefaultMaxSignedBodySize
+	}
+
+	body, err := httputil.ReadRequestBodyMax(req, maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Write(body)
+	return h.Sum(nil), nil
+}
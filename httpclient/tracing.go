@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/gojektech/heimdall"
+	"github.com/kitabisa/perkakas/v2/tracing"
+)
+
+type tracingDoer struct {
+	doer   heimdall.Doer
+	tracer *tracing.Tracer
+}
+
+// NewTracingDoer wrap doer to trace every request attempt with a client span, and propagate it to the server with
+// W3C traceparent header. The span is the child of the span in the request context.
+func NewTracingDoer(doer heimdall.Doer, tracer *tracing.Tracer) heimdall.Doer {
+	return &tracingDoer{
+		doer:   doer,
+		tracer: tracer,
+	}
+}
+
+func (d *tracingDoer) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := d.tracer.Start(req.Context(), "HTTP "+req.Method, tracing.WithSpanKind(tracing.SpanKindClient))
+	defer span.End()
+
+	tracing.SetHTTPClientAttributes(span, req)
+	span.SetAttribute(FieldAttempt, AttemptFromContext(ctx))
+
+	// the caller and the retry may reuse req, so the trace header is injected to the copy
+	req = req.Clone(ctx)
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := d.doer.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return resp, err
+	}
+
+	tracing.SetHTTPStatus(span, resp.StatusCode)
+	return resp, nil
+}
@@ -0,0 +1,155 @@
+package httputil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultMaxLogBodySize is the maximum body size captured for logging
+	DefaultMaxLogBodySize = 64 << 10 // 64KB
+
+	// DefaultMaxSignedBodySize is the maximum body size read for signing or verifying the signature
+	DefaultMaxSignedBodySize = 10 << 20 // 10MB
+)
+
+// ErrBodyTooLarge is returned by ReadRequestBodyMax when the body is larger than the maximum size
+var ErrBodyTooLarge = errors.New("perkakas/httputil: body is too large")
+
+var binaryMediaTypePrefixes = []string{
+	"multipart/",
+	"image/",
+	"audio/",
+	"video/",
+	"font/",
+	"application/octet-stream",
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+	"application/x-protobuf",
+	"application/grpc",
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ReadRequestBodyLimit capture at most limit bytes of the request body for logging. The body is left intact,
+// so the handler still read the whole body. Multipart and binary body is not read, the summary is returned instead.
+func ReadRequestBodyLimit(req *http.Request, limit int64) (bodyString string) {
+	bodyString, req.Body = readBodyLimit(req.Body, req.Header.Get("Content-Type"), req.ContentLength, limit)
+	return
+}
+
+// ReadResponseBodyLimit capture at most limit bytes of the response body for logging. The body is left intact.
+// Multipart and binary body is not read, the summary is returned instead.
+func ReadResponseBodyLimit(resp *http.Response, limit int64) (bodyString string) {
+	bodyString, resp.Body = readBodyLimit(resp.Body, resp.Header.Get("Content-Type"), resp.ContentLength, limit)
+	return
+}
+
+// ReadRequestBodyMax read the whole request body when it's at most max bytes, and restore it for the next reader.
+// The larger body is not buffered, ErrBodyTooLarge is returned instead.
+func ReadRequestBodyMax(req *http.Request, max int64) (body []byte, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.ContentLength > max {
+		return nil, ErrBodyTooLarge
+	}
+
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(req.Body, max+1))
+	body = buf.Bytes()
+
+	req.Body = &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(body), &errReader{err: err}, req.Body),
+		Closer: req.Body,
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n > max {
+		return nil, ErrBodyTooLarge
+	}
+
+	return body, nil
+}
+
+// IsBinaryContentType check whether the content type is multipart or binary, that should not be logged
+func IsBinaryContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, prefix := range binaryMediaTypePrefixes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readBodyLimit(body io.ReadCloser, contentType string, contentLength int64, limit int64) (bodyString string, restored io.ReadCloser) {
+	if body == nil || body == http.NoBody {
+		return "", body
+	}
+
+	if IsBinaryContentType(contentType) {
+		return summarizeBody(contentType, contentLength), body
+	}
+
+	if limit <= 0 {
+		limit = DefaultMaxLogBodySize
+	}
+
+	// read one more byte to know whether the body is truncated. The buffer grows as needed, instead of allocating
+	// the limit for every small body.
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(body, limit+1))
+	captured := buf.Bytes()
+
+	restored = &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(captured), &errReader{err: err}, body),
+		Closer: body,
+	}
+
+	if n > limit {
+		return fmt.Sprintf("%s...[truncated]", captured[:limit]), restored
+	}
+
+	return string(captured), restored
+}
+
+// errReader returns the read error other than EOF to the handler, so the error is not swallowed by logging
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.err == nil || r.err == io.EOF || r.err == io.ErrUnexpectedEOF {
+		return 0, io.EOF
+	}
+
+	return 0, r.err
+}
+
+func summarizeBody(contentType string, contentLength int64) string {
+	size := "unknown size"
+	if contentLength >= 0 {
+		size = fmt.Sprintf("%d bytes", contentLength)
+	}
+
+	return fmt.Sprintf("[%s body, %s]", contentType, size)
+}
@@ -0,0 +1,148 @@
+package httputil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderForwardedFor  = "X-Forwarded-For"
+	HeaderRealIP        = "X-Real-IP"
+	HeaderClientName    = "X-Ktbs-Client-Name"
+	HeaderClientVersion = "X-Ktbs-Client-Version"
+	HeaderPlatformName  = "X-Ktbs-Platform-Name"
+)
+
+// ClientInfo is the information of the client sending the request
+type ClientInfo struct {
+	IP            string    `json:"ip"`
+	UserAgent     UserAgent `json:"user_agent"`
+	ClientName    string    `json:"client_name,omitempty"`
+	ClientVersion string    `json:"client_version,omitempty"`
+	Platform      string    `json:"platform,omitempty"`
+}
+
+type clientInfoKey struct{}
+
+// ContextWithClientInfo returns a copy of ctx that carries the client info
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the client info stored in ctx
+func ClientInfoFromContext(ctx context.Context) (info ClientInfo, ok bool) {
+	if ctx == nil {
+		return
+	}
+
+	info, ok = ctx.Value(clientInfoKey{}).(ClientInfo)
+	return
+}
+
+// ClientIPResolver resolve the real client ip. X-Forwarded-For and X-Real-IP are only trusted when the request
+// comes from the trusted proxies, otherwise the client can spoof its ip by sending the header.
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver create resolver trusting the proxies in trustedCIDRs, e.g. "10.0.0.0/8".
+// Single ip without prefix length is accepted too.
+func NewClientIPResolver(trustedCIDRs ...string) (r *ClientIPResolver, err error) {
+	r = &ClientIPResolver{}
+	for _, cidr := range trustedCIDRs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		r.trusted = append(r.trusted, ipNet)
+	}
+
+	return
+}
+
+// MustNewClientIPResolver is like NewClientIPResolver but panics when the cidr is invalid
+func MustNewClientIPResolver(trustedCIDRs ...string) *ClientIPResolver {
+	r, err := NewClientIPResolver(trustedCIDRs...)
+	if err != nil {
+		panic("perkakas/httputil: invalid trusted cidr: " + err.Error())
+	}
+
+	return r
+}
+
+// ClientIP returns the real client ip of req. X-Forwarded-For is read from the right, skipping the trusted proxies,
+// so the first untrusted ip is the client. When X-Forwarded-For is empty, X-Real-IP is used.
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	remoteIP := hostIP(req.RemoteAddr)
+	if !r.isTrusted(remoteIP) {
+		return remoteIP
+	}
+
+	if forwardedFor := req.Header[HeaderForwardedFor]; len(forwardedFor) > 0 {
+		ips := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if net.ParseIP(ip) == nil {
+				// malformed entry can't be trusted, stop here
+				return remoteIP
+			}
+
+			if !r.isTrusted(ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(req.Header.Get(HeaderRealIP)); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return remoteIP
+}
+
+// ClientInfo resolve the client info of req from its ip, User-Agent, X-Ktbs-Client-Name, X-Ktbs-Client-Version and
+// X-Ktbs-Platform-Name header
+func (r *ClientIPResolver) ClientInfo(req *http.Request) ClientInfo {
+	return ClientInfo{
+		IP:            r.ClientIP(req),
+		UserAgent:     ParseUserAgent(req.UserAgent()),
+		ClientName:    req.Header.Get(HeaderClientName),
+		ClientVersion: req.Header.Get(HeaderClientVersion),
+		Platform:      req.Header.Get(HeaderPlatformName),
+	}
+}
+
+func (r *ClientIPResolver) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range r.trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hostIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
@@ -5,20 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"regexp"
 	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/kitabisa/perkakas/v2/random"
 )
 
-const passwordPattern = `(\\{0,1}"password\\{0,1}"):\s*\\{0,1}"(.*?)\\{0,1}"`
-var passRemover *regexp.Regexp
-
-func init() {
-	passRemover = regexp.MustCompile(passwordPattern)
-}
-
 func ReadRequestBody(req *http.Request) (bodyString string) {
 	var bodyBytes []byte
 	if req.Body != nil {
@@ -32,22 +24,18 @@ func ReadRequestBody(req *http.Request) (bodyString string) {
 	return
 }
 
-// ExcludeSensitiveHeader exclude sensitive header. Currently, sensitive header only Authorization
+// ExcludeSensitiveHeader returns copy of header with DefaultSensitiveHeaders value masked by DefaultRedactor
 func ExcludeSensitiveHeader(header http.Header) (h http.Header) {
-	h = make(http.Header)
-	for k, v := range header {
-		h[k] = v
-	}
-
-	h.Del("Authorization")
-	return
+	return DefaultRedactor.Header(header)
 }
 
+// ExcludeSensitiveRequestBody mask sensitive field of body with DefaultRedactor
 func ExcludeSensitiveRequestBody(body *string) {
-	result := passRemover.ReplaceAllString(*body, "")
-	*body = result
+	*body = DefaultRedactor.Body(*body, "")
 }
 
+// KitabisaHeader set the standard kitabisa header to req. When requestID is empty, the request id
+// stored in the request context is used, and a new one is generated if the context has none.
 func KitabisaHeader(req *http.Request, clientName, clientVersion, requestID string) *http.Request {
 	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 
@@ -55,6 +43,10 @@ func KitabisaHeader(req *http.Request, clientName, clientVersion, requestID stri
 		clientVersion = "1.0.0"
 	}
 
+	if requestID == "" {
+		requestID = RequestIDFromContext(req.Context())
+	}
+
 	if requestID == "" {
 		var err error
 		requestID, err = random.UUID()
@@ -67,7 +59,7 @@ func KitabisaHeader(req *http.Request, clientName, clientVersion, requestID stri
 		req.Header = make(http.Header)
 	}
 
-	req.Header.Set("X-Ktbs-Request-ID", requestID)
+	req.Header.Set(HeaderRequestID, requestID)
 	req.Header.Set("X-Ktbs-Client-Name", clientName)
 	req.Header.Set("X-Ktbs-Client-Version", clientVersion)
 	req.Header.Set("X-Ktbs-Time", timestamp)
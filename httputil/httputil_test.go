@@ -1,18 +1,169 @@
 package httputil
 
 import (
-	"github.com/stretchr/testify/assert"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestExcludeSensitiveRequestBody(t *testing.T) {
 	sourceText := `{"log_message":"user: Wrong username or password","method":"POST","request_body":"{\n\t\"username\": \"teta.kibites@gmail.com\",\n\t\"password\": \"k1tab1saa\"\n}","response_body":"{\"api_code\":101200,\"errors\":[{\"details\":{\"id\":\"Username atau password salah\",\"en\":\"Wrong username or password\"}}]}","stack":[{"message":"user: Wrong username or password"}]`
-	match := passRemover.MatchString(sourceText)
-	assert.True(t, match)
+	assert.Contains(t, sourceText, "k1tab1saa")
 
 	ExcludeSensitiveRequestBody(&sourceText)
 	t.Log(sourceText)
 
-	match = passRemover.MatchString(sourceText)
-	assert.False(t, match)
-}
\ No newline at end of file
+	assert.NotContains(t, sourceText, "k1tab1saa")
+	assert.Contains(t, sourceText, `\"password\": \"***\"`)
+}
+
+func TestRedactorJSONBody(t *testing.T) {
+	redactor := MustNewRedactor(RedactorConfig{
+		JSONPaths:   []string{"user.phone", "items.*.card_number"},
+		KeyPatterns: DefaultSensitiveKeyPatterns,
+	})
+
+	body := `{"user":{"name":"Budi","phone":"0812","PIN":123456},"items":[{"card_number":"4111","amount":10000}],"access_token":"abc","otp":null}`
+	result := redactor.Body(body, "application/json; charset=utf-8")
+
+	var redacted map[string]interface{}
+	err := json.Unmarshal([]byte(result), &redacted)
+	assert.Nil(t, err, "redacted body should be valid json")
+
+	user := redacted["user"].(map[string]interface{})
+	assert.Equal(t, "Budi", user["name"])
+	assert.Equal(t, RedactedValue, user["phone"])
+	assert.Equal(t, RedactedValue, user["PIN"])
+
+	item := redacted["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, RedactedValue, item["card_number"])
+	assert.Equal(t, float64(10000), item["amount"])
+
+	assert.Equal(t, RedactedValue, redacted["access_token"])
+	assert.Equal(t, RedactedValue, redacted["otp"])
+}
+
+func TestRedactorTruncatedJSONBody(t *testing.T) {
+	body := `{"name":"Budi","pin":123456,"card_number":4111111111111111,"amount":10000,"otp":true,"password":"k1tab1...[truncated]`
+	result := DefaultRedactor.Body(body, "application/json")
+
+	assert.NotContains(t, result, "123456")
+	assert.NotContains(t, result, "4111111111111111")
+	assert.NotContains(t, result, "k1tab1")
+	assert.Contains(t, result, `"pin":***`)
+	assert.Contains(t, result, `"otp":***`)
+	assert.Contains(t, result, `"amount":10000`)
+	assert.Contains(t, result, `"name":"Budi"`)
+}
+
+func TestRedactorFormBody(t *testing.T) {
+	result := DefaultRedactor.Body("username=budi&password=rahasia&nik=3171", "application/x-www-form-urlencoded")
+	assert.Equal(t, "nik=%2A%2A%2A&password=%2A%2A%2A&username=budi", result)
+}
+
+func TestRedactorHeader(t *testing.T) {
+	header := http.Header{
+		"Authorization": []string{"Bearer token"},
+		"Content-Type":  []string{"application/json"},
+	}
+
+	result := ExcludeSensitiveHeader(header)
+	assert.Equal(t, RedactedValue, result.Get("Authorization"))
+	assert.Equal(t, "application/json", result.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"), "original header should not be changed")
+}
+
+func TestReadRequestBodyLimit(t *testing.T) {
+	payload := strings.Repeat("a", 100)
+	req := httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(payload))
+
+	body := ReadRequestBodyLimit(req, 10)
+	assert.Equal(t, strings.Repeat("a", 10)+"...[truncated]", body)
+
+	b, err := ioutil.ReadAll(req.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, string(b), "handler should read the whole body")
+
+	req = httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(`{"amount":10000}`))
+	assert.Equal(t, `{"amount":10000}`, ReadRequestBodyLimit(req, 0))
+}
+
+func TestReadRequestBodyLimitBinary(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("--boundary\r\nfile content"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+
+	body := ReadRequestBodyLimit(req, 10)
+	assert.Equal(t, "[multipart/form-data; boundary=boundary body, 24 bytes]", body)
+
+	b, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, "--boundary\r\nfile content", string(b))
+}
+
+func TestReadRequestBodyMax(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(`{"amount":10000}`))
+	body, err := ReadRequestBodyMax(req, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"amount":10000}`, string(body))
+
+	b, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"amount":10000}`, string(b), "body should be restored")
+
+	req = httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(`{"amount":100000}`))
+	req.ContentLength = -1
+	_, err = ReadRequestBodyMax(req, 16)
+	assert.Equal(t, ErrBodyTooLarge, err)
+}
+
+func TestNewRequestID(t *testing.T) {
+	requestID := NewRequestID()
+	assert.Len(t, requestID, 36)
+	assert.NotEqual(t, requestID, NewRequestID())
+}
+
+func TestClientIP(t *testing.T) {
+	resolver := MustNewClientIPResolver("10.0.0.0/8", "192.168.1.1")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:5432"
+	req.Header.Set(HeaderForwardedFor, "1.1.1.1, 36.72.10.5, 192.168.1.1")
+	assert.Equal(t, "36.72.10.5", resolver.ClientIP(req), "spoofed leftmost ip should be ignored")
+
+	req.RemoteAddr = "36.72.10.5:5432"
+	assert.Equal(t, "36.72.10.5", resolver.ClientIP(req), "header from untrusted remote should be ignored")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:5432"
+	req.Header.Set(HeaderRealIP, "36.72.10.5")
+	assert.Equal(t, "36.72.10.5", resolver.ClientIP(req))
+
+	_, err := NewClientIPResolver("10.0.0.0/33")
+	assert.NotNil(t, err)
+}
+
+func TestParseUserAgent(t *testing.T) {
+	ua := ParseUserAgent("Mozilla/5.0 (Linux; Android 11; SM-A515F) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.210 Mobile Safari/537.36")
+	assert.Equal(t, "Chrome", ua.Browser)
+	assert.Equal(t, "90.0.4430.210", ua.BrowserVersion)
+	assert.Equal(t, "Android", ua.OS)
+	assert.Equal(t, "11", ua.OSVersion)
+	assert.Equal(t, DeviceMobile, ua.Device)
+
+	ua = ParseUserAgent("Mozilla/5.0 (iPad; CPU OS 14_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0.3 Mobile/15E148 Safari/604.1")
+	assert.Equal(t, "Safari", ua.Browser)
+	assert.Equal(t, "iOS", ua.OS)
+	assert.Equal(t, "14.4", ua.OSVersion)
+	assert.Equal(t, DeviceTablet, ua.Device)
+
+	ua = ParseUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36 Edg/90.0.818.56")
+	assert.Equal(t, "Edge", ua.Browser)
+	assert.Equal(t, DeviceDesktop, ua.Device)
+
+	ua = ParseUserAgent("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+	assert.True(t, ua.IsBot)
+	assert.Equal(t, DeviceBot, ua.Device)
+}
@@ -0,0 +1,238 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replace the value of sensitive header and field
+const RedactedValue = "***"
+
+var (
+	// DefaultSensitiveHeaders is the headers redacted by DefaultRedactor
+	DefaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+	// DefaultSensitiveKeyPatterns is the field key patterns redacted by DefaultRedactor. The pattern is matched case insensitive
+	// against the whole key.
+	DefaultSensitiveKeyPatterns = []string{"password", "pin", "otp", "card_number", "cvv", "nik", "secret", `.*token`}
+
+	// DefaultRedactor redact DefaultSensitiveHeaders and field matching DefaultSensitiveKeyPatterns
+	DefaultRedactor = MustNewRedactor(RedactorConfig{
+		Headers:     DefaultSensitiveHeaders,
+		KeyPatterns: DefaultSensitiveKeyPatterns,
+	})
+)
+
+// RedactorConfig is the configuration of redactor
+type RedactorConfig struct {
+	// Headers is the header names to be redacted
+	Headers []string
+
+	// JSONPaths is the dot separated path of json field to be redacted, e.g. "user.phone".
+	// Use * to match any key or array index, e.g. "items.*.card_number".
+	JSONPaths []string
+
+	// KeyPatterns is the regex matched case insensitive against the whole key of json and form field, e.g. "pin" or ".*token"
+	KeyPatterns []string
+}
+
+// Redactor mask sensitive header and body field with RedactedValue, while keeping the body valid
+type Redactor struct {
+	headers   map[string]bool
+	paths     [][]string
+	keys      []*regexp.Regexp
+	plainText *regexp.Regexp
+}
+
+// NewRedactor create redactor based on conf
+func NewRedactor(conf RedactorConfig) (r *Redactor, err error) {
+	r = &Redactor{
+		headers: make(map[string]bool),
+	}
+
+	for _, h := range conf.Headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	for _, p := range conf.JSONPaths {
+		r.paths = append(r.paths, strings.Split(p, "."))
+	}
+
+	for _, k := range conf.KeyPatterns {
+		re, err := regexp.Compile(`^(?i:` + k + `)$`)
+		if err != nil {
+			return nil, err
+		}
+
+		r.keys = append(r.keys, re)
+	}
+
+	if len(conf.KeyPatterns) > 0 {
+		// matches "key": "value" or "key": 123 on text that is not valid json, e.g. truncated body, including escaped
+		// json inside json string. The quoted value of truncated body may not have the closing quote.
+		pattern := `(\\?"(?i:` + strings.Join(conf.KeyPatterns, "|") + `)\\?"\s*:\s*)(?:(\\?")(.*?)(\\?"|$)|[^\s,}\]\\"]+)`
+		r.plainText, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// MustNewRedactor is like NewRedactor but panics when the config is invalid
+func MustNewRedactor(conf RedactorConfig) *Redactor {
+	r, err := NewRedactor(conf)
+	if err != nil {
+		panic("perkakas/httputil: invalid redactor config: " + err.Error())
+	}
+
+	return r
+}
+
+// Header returns copy of header with sensitive header value replaced by RedactedValue
+func (r *Redactor) Header(header http.Header) (h http.Header) {
+	h = make(http.Header)
+	for k, v := range header {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			h[k] = []string{RedactedValue}
+			continue
+		}
+
+		h[k] = v
+	}
+
+	return
+}
+
+// Body returns body with sensitive field value replaced by RedactedValue. Json and form-urlencoded body are decoded,
+// so the result is still valid. When content type is empty, the body is treated as json if it's valid json.
+func (r *Redactor) Body(body string, contentType string) string {
+	if body == "" {
+		return body
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return r.form(body)
+	case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if redacted, ok := r.json(body); ok {
+			return redacted
+		}
+	}
+
+	return r.text(body)
+}
+
+func (r *Redactor) json(body string) (redacted string, ok bool) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return
+	}
+
+	v = r.redactValue(v, nil)
+
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+func (r *Redactor) redactValue(v interface{}, path []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			childPath := append(append([]string{}, path...), k)
+			if r.isSensitive(k, childPath) {
+				val[k] = RedactedValue
+				continue
+			}
+
+			val[k] = r.redactValue(child, childPath)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactValue(child, append(append([]string{}, path...), "*"))
+		}
+	}
+
+	return v
+}
+
+func (r *Redactor) form(body string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return r.text(body)
+	}
+
+	for k, v := range values {
+		if r.isSensitive(k, []string{k}) {
+			for i := range v {
+				v[i] = RedactedValue
+			}
+		}
+	}
+
+	return values.Encode()
+}
+
+func (r *Redactor) text(body string) string {
+	if r.plainText == nil {
+		return body
+	}
+
+	return r.plainText.ReplaceAllString(body, "${1}${2}"+RedactedValue+"${4}")
+}
+
+func (r *Redactor) isSensitive(key string, path []string) bool {
+	for _, re := range r.keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	for _, p := range r.paths {
+		if matchPath(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+
+	for i := range pattern {
+		if pattern[i] != "*" && path[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+
+		// array index in path only matched by *
+		if path[i] == "*" && pattern[i] != "*" {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,39 @@
+package httputil
+
+import (
+	"context"
+
+	"github.com/kitabisa/perkakas/v2/random"
+	uuid "github.com/satori/go.uuid"
+)
+
+// HeaderRequestID is the header carrying the request id between kitabisa services
+const HeaderRequestID = "X-Ktbs-Request-ID"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx that carries the request id
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id stored in ctx, or empty string if there is none
+func RequestIDFromContext(ctx context.Context) (requestID string) {
+	if ctx == nil {
+		return
+	}
+
+	requestID, _ = ctx.Value(requestIDKey{}).(string)
+	return
+}
+
+// NewRequestID generates a random request id. When the random source fails, a time based uuid is used instead,
+// so the request id is never empty.
+func NewRequestID() string {
+	requestID, err := random.UUID()
+	if err != nil {
+		return uuid.NewV1().String()
+	}
+
+	return requestID
+}
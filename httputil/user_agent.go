@@ -0,0 +1,95 @@
+package httputil
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is the parsed User-Agent header
+type UserAgent struct {
+	Raw            string `json:"raw,omitempty"`
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device"`
+	IsBot          bool   `json:"is_bot"`
+}
+
+type uaPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var (
+	// the order matters, e.g. edge and opera user agent contain Chrome and Safari too
+	browserPatterns = []uaPattern{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+		{"okhttp", regexp.MustCompile(`okhttp/([\d.]+)`)},
+		{"Go", regexp.MustCompile(`Go-http-client/([\d.]+)`)},
+		{"curl", regexp.MustCompile(`curl/([\d.]+)`)},
+	}
+
+	osPatterns = []uaPattern{
+		{"Windows", regexp.MustCompile(`Windows NT ([\d.]+)`)},
+		{"iOS", regexp.MustCompile(`(?:iPhone|iPad|iPod).*? OS ([\d_]+)`)},
+		{"Android", regexp.MustCompile(`Android ([\d.]+)`)},
+		{"macOS", regexp.MustCompile(`Mac OS X ([\d_.]+)`)},
+		{"Chrome OS", regexp.MustCompile(`CrOS \S+ ([\d.]+)`)},
+		{"Linux", regexp.MustCompile(`Linux()`)},
+	}
+
+	botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|facebookexternalhit|headless|lighthouse`)
+)
+
+// ParseUserAgent parse the browser, os and device type from the User-Agent header. Unrecognized part is left empty.
+func ParseUserAgent(ua string) (userAgent UserAgent) {
+	userAgent.Raw = ua
+	userAgent.Device = DeviceUnknown
+	if ua == "" {
+		return
+	}
+
+	userAgent.Browser, userAgent.BrowserVersion = matchUserAgent(browserPatterns, ua)
+	userAgent.OS, userAgent.OSVersion = matchUserAgent(osPatterns, ua)
+	userAgent.OSVersion = strings.Replace(userAgent.OSVersion, "_", ".", -1)
+
+	switch {
+	case botPattern.MatchString(ua):
+		userAgent.IsBot = true
+		userAgent.Device = DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(userAgent.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		userAgent.Device = DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		userAgent.Device = DeviceMobile
+	case userAgent.OS == "Windows" || userAgent.OS == "macOS" || userAgent.OS == "Linux" || userAgent.OS == "Chrome OS":
+		userAgent.Device = DeviceDesktop
+	}
+
+	return
+}
+
+func matchUserAgent(patterns []uaPattern, ua string) (name, version string) {
+	for _, p := range patterns {
+		if match := p.re.FindStringSubmatch(ua); match != nil {
+			return p.name, match[1]
+		}
+	}
+
+	return
+}
@@ -0,0 +1,145 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrWriterClosed is returned when writing to the closed AsyncWriter
+var ErrWriterClosed = errors.New("perkakas/log: writer is closed")
+
+// DropPolicy decide what AsyncWriter does when the buffer is full
+type DropPolicy int
+
+const (
+	// DropNewest discard the entry being written. This is the default policy.
+	DropNewest DropPolicy = iota
+
+	// DropOldest discard the oldest buffered entry to make room for the entry being written
+	DropOldest
+
+	// Block wait until the buffer has room. The caller is blocked when the sink is slow.
+	Block
+)
+
+const defaultAsyncBufferSize = 1024
+
+type asyncEntry struct {
+	level Level
+	p     []byte
+}
+
+// AsyncWriter buffer the entries and write them to the sink in background, so a slow sink doesn't block the caller.
+// When the buffer is full, the entry is handled by the DropPolicy.
+type AsyncWriter struct {
+	w       io.Writer
+	policy  DropPolicy
+	entries chan asyncEntry
+	dropped uint64
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter create async writer to w with buffer of bufferSize entries. Default buffer size is 1024.
+func NewAsyncWriter(w io.Writer, bufferSize int, policy DropPolicy) *AsyncWriter {
+	if bufferSize <= 0 {
+		bufferSize = defaultAsyncBufferSize
+	}
+
+	a := &AsyncWriter{
+		w:       w,
+		policy:  policy,
+		entries: make(chan asyncEntry, bufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) Write(p []byte) (n int, err error) {
+	return a.WriteLevel(TraceLevel, p)
+}
+
+// WriteLevel buffer the entry with its level, passed to the sink when it implements LevelWriter
+func (a *AsyncWriter) WriteLevel(level Level, p []byte) (n int, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, ErrWriterClosed
+	}
+
+	// the caller may reuse p after Write returns
+	entry := asyncEntry{level: level, p: append([]byte(nil), p...)}
+
+	switch a.policy {
+	case Block:
+		a.entries <- entry
+	case DropOldest:
+		for {
+			select {
+			case a.entries <- entry:
+				return len(p), nil
+			default:
+			}
+
+			select {
+			case <-a.entries:
+				atomic.AddUint64(&a.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.entries <- entry:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of entries dropped because the buffer is full
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close write the buffered entries, then close the sink when it implements io.Closer
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+
+	<-a.done
+
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	for entry := range a.entries {
+		if lw, ok := a.w.(LevelWriter); ok {
+			lw.WriteLevel(entry.level, entry.p)
+			continue
+		}
+
+		a.w.Write(entry.p)
+	}
+}
@@ -0,0 +1,56 @@
+package log
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx that carries the logger
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = NewLogger("")
+)
+
+// SetDefaultLogger set the logger used by FromContext when there is no logger in the context, usually the root logger
+// of the service, so the entries keep its service name, sinks, level and redactor. Nil logger reset it to the default
+// logger writing to stdout.
+func SetDefaultLogger(logger *Logger) {
+	if logger == nil {
+		logger = NewLogger("")
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLogger = logger
+}
+
+// DefaultLogger returns the logger set by SetDefaultLogger
+func DefaultLogger() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultLogger
+}
+
+// FromContext returns the logger stored in ctx by middleware.NewHttpRequestLogger. When there is none,
+// child logger of DefaultLogger is returned, using the request id in ctx as the log id and the trace of the span in ctx.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+
+	logger := DefaultLogger().newChildLogger(httputil.RequestIDFromContext(ctx))
+	logger.SetTrace(ctx)
+	return logger
+}
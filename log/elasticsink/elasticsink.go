@@ -0,0 +1,368 @@
+// Package elasticsink is the log sink indexing the entries to elasticsearch. It's separated from the log package,
+// so the services only logging to stdout or file don't depend on the elasticsearch client.
+package elasticsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	es "github.com/olivere/elastic/v7"
+
+	"github.com/kitabisa/perkakas/v2/elastic"
+	"github.com/kitabisa/perkakas/v2/log"
+)
+
+const (
+	defaultIndexPrefix         = "logs"
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultBulkActions         = 500
+	defaultFlushInterval       = time.Second
+	defaultBufferSize          = 1024
+)
+
+// Config is the configuration of elasticsearch sink
+type Config struct {
+	// Service is used in the index name, <IndexPrefix>-<Service>-YYYY.MM.DD
+	Service string
+
+	// IndexPrefix is the index name prefix. Default is logs.
+	IndexPrefix string
+
+	// NodeURL is pinged every HealthCheckInterval. When the ping or the bulk request fails, the entry is written to
+	// Fallback until the next health check succeeds. When NodeURL is empty, only the bulk request failure is checked.
+	// Default interval is 10 seconds.
+	NodeURL             string
+	HealthCheckInterval time.Duration
+
+	// Workers, BulkActions and FlushInterval configure the dedicated bulk processor. Default is 1 worker,
+	// flushing every 500 entries or 1 second.
+	Workers       int
+	BulkActions   int
+	FlushInterval time.Duration
+
+	// BufferSize is the number of entries waiting to be added to the bulk processor. When the buffer is full, e.g.
+	// the bulk processor is retrying the commit, the entry is written to Fallback, so Write never blocks.
+	// Default is 1024.
+	BufferSize int
+
+	// Fallback receives the entry when elasticsearch is down or rejects the entry. Default is stdout.
+	Fallback io.Writer
+}
+
+type entry struct {
+	index string
+	doc   json.RawMessage
+}
+
+// Sink index the entries to daily elasticsearch index through a dedicated bulk processor. The index template is
+// created with the mappings of the log fields. The entry must be formatted as json, see log.FormatJSON.
+type Sink struct {
+	client        elastic.ElasticClient
+	conf          Config
+	processorName string
+	templateName  string
+
+	mu            sync.RWMutex
+	down          bool
+	templateReady bool
+
+	// fallbackMu serializes the fallback writes from Write and from the bulk processor worker
+	fallbackMu sync.Mutex
+
+	// entries is closed by Close, closing guards Write from sending to the closed channel
+	processor *es.BulkProcessor
+	entries   chan entry
+	closingMu sync.RWMutex
+	closing   bool
+	addDone   chan struct{}
+
+	stop   chan struct{}
+	closed sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewSink create the bulk processor, then create the index template in background. Until the index template is
+// created, e.g. when elasticsearch is down, the entry is written to the fallback.
+func NewSink(client elastic.ElasticClient, conf Config) (sink *Sink, err error) {
+	if conf.IndexPrefix == "" {
+		conf.IndexPrefix = defaultIndexPrefix
+	}
+
+	if conf.HealthCheckInterval <= 0 {
+		conf.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	if conf.Workers <= 0 {
+		conf.Workers = 1
+	}
+
+	if conf.BulkActions <= 0 {
+		conf.BulkActions = defaultBulkActions
+	}
+
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = defaultBufferSize
+	}
+
+	if conf.Fallback == nil {
+		conf.Fallback = os.Stdout
+	}
+
+	sink = &Sink{
+		client:        client,
+		conf:          conf,
+		processorName: fmt.Sprintf("%s-%s", conf.IndexPrefix, conf.Service),
+		templateName:  fmt.Sprintf("%s-%s", conf.IndexPrefix, conf.Service),
+		entries:       make(chan entry, conf.BufferSize),
+		addDone:       make(chan struct{}),
+		stop:          make(chan struct{}),
+	}
+
+	err = client.AddBulkProcessor(elastic.BulkProcessor{
+		Name:          sink.processorName,
+		Workers:       conf.Workers,
+		BulkActions:   conf.BulkActions,
+		BulkSize:      2 << 20,
+		FlushInterval: conf.FlushInterval,
+		After:         sink.after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sink.processor, err = client.GetBulkProcessor(sink.processorName)
+	if err != nil {
+		return nil, err
+	}
+
+	go sink.add()
+
+	sink.wg.Add(1)
+	go sink.healthCheck()
+
+	return
+}
+
+// LogIndexTemplate returns the index template of the log fields for the index pattern
+func LogIndexTemplate(pattern string) *elastic.IndexTemplate {
+	mappings := elastic.NewMappings().
+		AddDynamicTemplate("strings_as_keyword", elastic.MatchConditions{
+			MatchMappingType: "string",
+			Mapping: elastic.MatchMapping{
+				Type: "keyword",
+			},
+		}).
+		AddPropertyWithType("time", "date").
+		AddPropertyWithType("level", "keyword").
+		AddPropertyWithType(log.FieldLogID, "keyword").
+		AddPropertyWithType(log.FieldServiceName, "keyword").
+		AddPropertyWithType("log_message", "text").
+		AddPropertyWithType(log.FieldEndpoint, "keyword").
+		AddPropertyWithType(log.FieldMethod, "keyword").
+		AddPropertyWithType(log.FieldUserID, "keyword").
+		AddPropertyWithType(log.FieldHTTPStatus, "integer").
+		AddPropertyWithType(log.FieldLatency, "float").
+		AddPropertyWithType(log.FieldResponseSize, "long").
+		AddPropertyWithType(log.FieldRepeated, "long").
+		AddPropertyWithType(log.FieldErrorCode, "keyword").
+		AddPropertyWithType(log.FieldTraceID, "keyword").
+		AddPropertyWithType(log.FieldSpanID, "keyword").
+		AddPropertyWithType(log.FieldRequestBody, "text").
+		AddPropertyWithType(log.FieldResponseBody, "text").
+		AddPropertyWithType(log.FieldRequestHeaders, "flattened").
+		AddPropertyWithType(log.FieldResponseHeaders, "flattened").
+		AddPropertyWithType(log.FieldClientInfo, "flattened").
+		AddPropertyWithType("stack", "flattened")
+
+	return &elastic.IndexTemplate{
+		IndexPatterns: []string{pattern},
+		Settings: map[string]interface{}{
+			"index.refresh_interval": "5s",
+		},
+		Mappings: mappings,
+	}
+}
+
+// Write enqueue the entry for the bulk processor without blocking. The entry is written to the fallback when
+// elasticsearch is down, the buffer is full or the sink is closed.
+func (s *Sink) Write(p []byte) (n int, err error) {
+	if !s.isAvailable() {
+		return s.writeFallback(p)
+	}
+
+	doc := bytes.TrimSpace(p)
+	if !json.Valid(doc) {
+		// the entry is not formatted as json, index it as the message
+		doc, _ = json.Marshal(map[string]interface{}{
+			"time":        time.Now().Format(time.RFC3339),
+			"log_message": string(doc),
+		})
+	}
+
+	index := fmt.Sprintf("%s-%s-%s", s.conf.IndexPrefix, s.conf.Service, time.Now().UTC().Format("2006.01.02"))
+
+	s.closingMu.RLock()
+	defer s.closingMu.RUnlock()
+
+	if s.closing {
+		return s.writeFallback(p)
+	}
+
+	// the caller may reuse p after Write returns
+	select {
+	case s.entries <- entry{index: index, doc: append([]byte(nil), doc...)}:
+		return len(p), nil
+	default:
+		return s.writeFallback(p)
+	}
+}
+
+// Close flush the buffered entries, then stop the bulk processor and the health check
+func (s *Sink) Close() (err error) {
+	s.closed.Do(func() {
+		s.closingMu.Lock()
+		s.closing = true
+		close(s.entries)
+		s.closingMu.Unlock()
+
+		<-s.addDone
+
+		close(s.stop)
+		s.wg.Wait()
+
+		err = s.processor.Close()
+	})
+
+	return
+}
+
+// add the buffered entries to the bulk processor. Add blocks while the worker is committing, e.g. retrying against
+// the unreachable elasticsearch, so it's done here instead of on the caller goroutine. The index is created from
+// the index template, so the entry is added directly instead of through BulkStore, which checks the index.
+func (s *Sink) add() {
+	defer close(s.addDone)
+
+	for e := range s.entries {
+		s.processor.Add(es.NewBulkIndexRequest().Type("_doc").Index(e.index).Doc(e.doc))
+	}
+}
+
+func (s *Sink) isAvailable() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.down && s.templateReady
+}
+
+func (s *Sink) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+}
+
+// checkHealth ping elasticsearch, then create the index template when it's not created yet
+func (s *Sink) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.conf.HealthCheckInterval)
+	defer cancel()
+
+	if s.conf.NodeURL != "" {
+		if _, _, err := s.client.Ping(ctx, s.conf.NodeURL); err != nil {
+			s.setDown(true)
+			return
+		}
+	}
+
+	s.mu.RLock()
+	templateReady := s.templateReady
+	s.mu.RUnlock()
+
+	if !templateReady {
+		pattern := fmt.Sprintf("%s-%s-*", s.conf.IndexPrefix, s.conf.Service)
+		if _, err := s.client.PutIndexTemplate(ctx, s.templateName, LogIndexTemplate(pattern)); err != nil {
+			s.setDown(true)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.down = false
+	s.templateReady = true
+	s.mu.Unlock()
+}
+
+func (s *Sink) healthCheck() {
+	defer s.wg.Done()
+
+	s.checkHealth()
+
+	ticker := time.NewTicker(s.conf.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkHealth()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// after write the entries failed to be indexed to the fallback, so they are not lost
+func (s *Sink) after(executionID int64, requests []es.BulkableRequest, response *es.BulkResponse, err error) {
+	if err != nil {
+		s.setDown(true)
+		for _, req := range requests {
+			s.writeFallbackRequest(req)
+		}
+
+		return
+	}
+
+	if response == nil || !response.Errors {
+		return
+	}
+
+	// the response items are in the same order as the requests
+	for i, item := range response.Items {
+		if i >= len(requests) {
+			break
+		}
+
+		for _, result := range item {
+			if result.Error != nil || result.Status >= 300 {
+				s.writeFallbackRequest(requests[i])
+			}
+		}
+	}
+}
+
+func (s *Sink) writeFallback(p []byte) (n int, err error) {
+	s.fallbackMu.Lock()
+	defer s.fallbackMu.Unlock()
+
+	return s.conf.Fallback.Write(p)
+}
+
+func (s *Sink) writeFallbackRequest(req es.BulkableRequest) {
+	lines, err := req.Source()
+	if err != nil || len(lines) < 2 {
+		return
+	}
+
+	s.fallbackMu.Lock()
+	defer s.fallbackMu.Unlock()
+
+	fmt.Fprintln(s.conf.Fallback, lines[1])
+}
@@ -0,0 +1,155 @@
+package elasticsink
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kitabisa/perkakas/v2/elastic"
+	"github.com/kitabisa/perkakas/v2/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		template string
+		bulk     []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_template/"):
+			template = string(body)
+			w.Write([]byte(`{"acknowledged":true}`))
+		case r.URL.Path == "/_bulk":
+			bulk = append(bulk, string(body))
+			// reject the second document
+			w.Write([]byte(`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	fallback := new(bytes.Buffer)
+	sink, err := NewSink(client, Config{
+		Service:       "donation",
+		NodeURL:       ts.URL,
+		BulkActions:   2,
+		FlushInterval: time.Hour,
+		Fallback:      fallback,
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i < 100 && !sink.isAvailable(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, sink.isAvailable())
+
+	logger := log.NewLogger("donation", log.WithSinks(sink))
+	logger.Info("first").Print()
+	logger.Info("second").Print()
+	assert.Nil(t, logger.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Contains(t, template, `"index_patterns":["logs-donation-*"]`)
+	assert.Len(t, bulk, 1)
+	assert.Contains(t, bulk[0], fmt.Sprintf(`"_index":"logs-donation-%s"`, time.Now().UTC().Format("2006.01.02")))
+	assert.Contains(t, bulk[0], `"log_message":"first"`)
+	assert.Contains(t, fallback.String(), `"log_message":"second"`, "rejected entry should be written to fallback")
+	assert.NotContains(t, fallback.String(), `"log_message":"first"`)
+}
+
+func TestSinkDown(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	fallback := new(bytes.Buffer)
+	sink, err := NewSink(client, Config{
+		Service:             "donation",
+		HealthCheckInterval: 50 * time.Millisecond,
+		Fallback:            fallback,
+	})
+	assert.Nil(t, err)
+
+	logger := log.NewLogger("donation", log.WithSinks(sink))
+	logger.Info("elastic is down").Print()
+	assert.Nil(t, logger.Close())
+
+	assert.Contains(t, fallback.String(), `"log_message":"elastic is down"`)
+}
+
+func TestSinkBufferFull(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/_bulk" {
+			// elasticsearch is slow, the bulk processor worker is busy committing
+			<-release
+			w.Write([]byte(`{"errors":false,"items":[]}`))
+			return
+		}
+
+		w.Write([]byte(`{"acknowledged":true}`))
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(ts.URL)
+	if err != nil {
+		t.FailNow()
+	}
+
+	fallback := new(bytes.Buffer)
+	sink, err := NewSink(client, Config{
+		Service:       "donation",
+		BulkActions:   1,
+		FlushInterval: time.Hour,
+		BufferSize:    1,
+		Fallback:      fallback,
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i < 100 && !sink.isAvailable(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, sink.isAvailable())
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err = fmt.Fprintf(sink, `{"log_message":"entry %d"}`+"\n", i)
+		assert.Nil(t, err)
+	}
+	assert.True(t, time.Since(start) < time.Second, "write should not wait for the bulk processor")
+
+	close(release)
+	assert.Nil(t, sink.Close())
+
+	assert.Contains(t, fallback.String(), `"log_message":"entry 9"`, "entry should be written to fallback when the buffer is full")
+}
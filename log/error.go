@@ -0,0 +1,45 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/kitabisa/perkakas/v2/errors"
+	"github.com/kitabisa/perkakas/v2/structs"
+)
+
+// errorDetail is the detail of the error message
+type errorDetail struct {
+	Chain      []errorCause   `json:"chain,omitempty"`
+	Code       string         `json:"code,omitempty"`
+	HTTPStatus int            `json:"http_status,omitempty"`
+	StackTrace []errors.Frame `json:"stacktrace,omitempty"`
+}
+
+// errorCause is an error in the unwrap chain
+type errorCause struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// newErrorDetail walk the unwrap chain of err, and take the stack trace recorded by the errors package and
+// the code of *structs.ErrorResponse in the chain
+func newErrorDetail(err error) (detail *errorDetail) {
+	detail = &errorDetail{
+		StackTrace: errors.StackTrace(err),
+	}
+
+	for cause := err; cause != nil; cause = errors.Unwrap(cause) {
+		detail.Chain = append(detail.Chain, errorCause{
+			Type:    fmt.Sprintf("%T", cause),
+			Message: cause.Error(),
+		})
+	}
+
+	var errResponse *structs.ErrorResponse
+	if errors.As(err, &errResponse) {
+		detail.Code = errResponse.ResponseCode
+		detail.HTTPStatus = errResponse.HttpStatus
+	}
+
+	return
+}
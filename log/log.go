@@ -1,12 +1,14 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 
 	"github.com/kitabisa/perkakas/v2/httputil"
 	"github.com/kitabisa/perkakas/v2/token/jwt"
+	"github.com/kitabisa/perkakas/v2/tracing"
 )
 
 type Level uint32
@@ -30,14 +33,23 @@ const (
 	FieldRequestHeaders  = "request_headers"
 	FieldResponseBody    = "response_body"
 	FieldResponseHeaders = "response_headers"
+	FieldLatency         = "latency_ms"
+	FieldClientInfo      = "client_info"
+	FieldResponseSize    = "response_size"
+	FieldRepeated        = "repeated"
+	FieldErrorCode       = "error_code"
+	FieldTraceID         = "trace_id"
+	FieldSpanID          = "span_id"
 )
 
 type message struct {
-	Message  interface{} `json:"message"`
-	Level    Level       `json:"level"`
-	File     string      `json:"file"`
-	FuncName string      `json:"func"`
-	Line     int         `json:"line"`
+	Message  interface{}            `json:"message"`
+	Level    Level                  `json:"level"`
+	File     string                 `json:"file"`
+	FuncName string                 `json:"func"`
+	Line     int                    `json:"line"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Error    *errorDetail           `json:"error,omitempty"`
 }
 
 const (
@@ -72,82 +84,271 @@ func (level Level) MarshalText() ([]byte, error) {
 }
 
 type Logger struct {
-	logger  *log.Logger
-	fields  sync.Map
-	id      string
-	service string
+	logger      *log.Logger
+	fields      sync.Map
+	id          string
+	service     string
+	redactor    *httputil.Redactor
+	maxBodySize int64
+	level       Level
+	opts        *options
+
+	// scoped is the request fields set by SetRequest, kept for every entry of the logger
+	scoped sync.Map
+
+	// seeded is true when the log id is given, e.g. the request id, so every entry of the logger keeps it.
+	// Otherwise each entry gets a new log id.
+	seeded bool
 }
 
 func (l *Logger) NewChildLogger() (logger *Logger) {
-	logger = newLogger(l.service, l.id)
+	logger = l.newChildLogger(l.id)
+	logger.seeded = l.seeded
 	return
 }
 
+// newChildLogger create child logger with its own log id, generated when logID is empty
+func (l *Logger) newChildLogger(logID string) (logger *Logger) {
+	logger = newLogger(l.service, logID, l.opts)
+	logger.redactor = l.redactor
+	logger.maxBodySize = l.maxBodySize
+	logger.level = l.level
+	return
+}
+
+// SetLevel set the minimum severity level of the message added to the logger. Message less severe than level is discarded.
+// Default is TraceLevel, which keeps all messages.
+func (l *Logger) SetLevel(level Level) {
+	l.level = level
+}
+
+// SetMaxBodySize set the maximum request body size captured by SetRequest. Default is httputil.DefaultMaxLogBodySize.
+func (l *Logger) SetMaxBodySize(size int64) {
+	l.maxBodySize = size
+}
+
+// SetRedactor set the redactor for masking sensitive header and body on SetRequest and SetResponse.
+// Default is httputil.DefaultRedactor. Nil redactor is ignored, so the sensitive data is never logged unmasked.
+func (l *Logger) SetRedactor(redactor *httputil.Redactor) {
+	if redactor == nil {
+		return
+	}
+
+	l.redactor = redactor
+}
+
+// SetRequest set the request fields, e.g. endpoint, method, headers and body. Unlike SetField, the request fields
+// are kept after Print, so every entry of the request has them.
 func (l *Logger) SetRequest(req interface{}) {
 	switch v := req.(type) {
 	case *http.Request:
 		token, ok := v.Context().Value("token").(*jwt.UserClaim)
 		if ok {
-			l.fields.Store(FieldUserID, token.UserID)
+			l.setScoped(FieldUserID, token.UserID)
 		}
 
-		header := httputil.ExcludeSensitiveHeader(v.Header)
+		if requestID := httputil.RequestIDFromContext(v.Context()); requestID != "" {
+			l.id, l.seeded = requestID, true
+			l.fields.Store(FieldLogID, requestID)
+		}
+
+		l.SetTrace(v.Context())
+
+		if clientInfo, ok := httputil.ClientInfoFromContext(v.Context()); ok {
+			l.setScoped(FieldClientInfo, clientInfo)
+		}
+
+		header := l.redactor.Header(v.Header)
 
-		l.fields.Store(FieldEndpoint, v.URL.String())
-		l.fields.Store(FieldMethod, v.Method)
-		l.fields.Store(FieldRequestHeaders, header)
+		l.setScoped(FieldEndpoint, v.URL.String())
+		l.setScoped(FieldMethod, v.Method)
+		l.setScoped(FieldRequestHeaders, header)
 
 		switch v.Method {
 		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
-			body := httputil.ReadRequestBody(v)
-			httputil.ExcludeSensitiveRequestBody(&body)
+			body := httputil.ReadRequestBodyLimit(v, l.maxBodySize)
+			body = l.redactor.Body(body, v.Header.Get("Content-Type"))
 
-			l.fields.Store(FieldRequestBody, body)
+			l.setScoped(FieldRequestBody, body)
 		}
 	default:
-		l.fields.Store(FieldRequestBody, req)
+		l.setScoped(FieldRequestBody, req)
 	}
 }
 
 func (l *Logger) SetResponse(res interface{}, body []byte) {
 	switch v := res.(type) {
 	case http.ResponseWriter:
-		l.fields.Store(FieldResponseHeaders, v.Header())
-		l.fields.Store(FieldResponseBody, string(body))
+		l.fields.Store(FieldResponseHeaders, l.redactor.Header(v.Header()))
+		l.fields.Store(FieldResponseBody, l.redactor.Body(string(body), v.Header().Get("Content-Type")))
 	case *http.Response:
-		l.fields.Store(FieldResponseHeaders, v.Header)
-		l.fields.Store(FieldResponseBody, string(body))
+		l.fields.Store(FieldHTTPStatus, v.StatusCode)
+		l.fields.Store(FieldResponseHeaders, l.redactor.Header(v.Header))
+		l.fields.Store(FieldResponseBody, l.redactor.Body(string(body), v.Header.Get("Content-Type")))
 	}
 }
 
+// SetTrace set trace_id and span_id of the span in ctx, started by tracing package. SetRequest calls it with
+// the request context. Like the request fields, they are kept after Print.
+func (l *Logger) SetTrace(ctx context.Context) {
+	sc := tracing.SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+
+	l.setScoped(FieldTraceID, sc.TraceID.String())
+	l.setScoped(FieldSpanID, sc.SpanID.String())
+}
+
+// setScoped set the request field, kept after Print
+func (l *Logger) setScoped(key string, value interface{}) {
+	l.scoped.Store(key, value)
+	l.fields.Store(key, value)
+}
+
+// SetField set additional field to the log. The field is cleared after Print.
+func (l *Logger) SetField(key string, value interface{}) {
+	l.fields.Store(key, value)
+}
+
 func (l *Logger) AddMessage(level Level, message ...interface{}) *Logger {
-	l.setCaller(level, 2, message...)
+	l.setCaller(level, 2, nil, message...)
+	return l
+}
+
+// Error add error message with key value fields, e.g. logger.Error(err, "order_id", id)
+func (l *Logger) Error(msg interface{}, keysAndValues ...interface{}) *Logger {
+	l.setCaller(ErrorLevel, 2, toFields(keysAndValues), msg)
+	return l
+}
+
+// Warn add warning message with key value fields
+func (l *Logger) Warn(msg interface{}, keysAndValues ...interface{}) *Logger {
+	l.setCaller(WarnLevel, 2, toFields(keysAndValues), msg)
+	return l
+}
+
+// Info add info message with key value fields
+func (l *Logger) Info(msg interface{}, keysAndValues ...interface{}) *Logger {
+	l.setCaller(InfoLevel, 2, toFields(keysAndValues), msg)
+	return l
+}
+
+// Debug add debug message with key value fields
+func (l *Logger) Debug(msg interface{}, keysAndValues ...interface{}) *Logger {
+	l.setCaller(DebugLevel, 2, toFields(keysAndValues), msg)
+	return l
+}
+
+// Trace add trace message with key value fields
+func (l *Logger) Trace(msg interface{}, keysAndValues ...interface{}) *Logger {
+	l.setCaller(TraceLevel, 2, toFields(keysAndValues), msg)
 	return l
 }
 
 func (l *Logger) Print(directMsg ...interface{}) {
 	if len(directMsg) > 0 {
-		l.setCaller(DebugLevel, 2, directMsg...)
+		l.setCaller(DebugLevel, 2, nil, directMsg...)
 	}
 
 	stackVal, _ := l.fields.Load("stack")
 	messages := ensureStackType(stackVal)
 
 	if len(messages) > 0 {
-		maxLevel := l.findMaxLevel(messages)
-		if maxLevel < WarnLevel {
-			l.logger.SetOutput(os.Stderr)
-		} else {
-			l.logger.SetOutput(os.Stdout)
+		level, msg := l.findMaxLevel(messages), joinMessages(messages)
+		if l.opts.sampler == nil || l.opts.sampler.allow(level, msg) {
+			l.write(level, msg)
 		}
-
-		entry := l.logger.WithFields(l.syncMapToLogFields())
-		entry.Tracef("%+v", messages[0].Message)
 	}
 
 	l.clear()
 }
 
+// write print the entry with the given severity level. logrus panics on PanicLevel entry, so the entry is formatted
+// and written directly. The severity here only tells how severe the messages are.
+func (l *Logger) write(level Level, msg string) {
+	entry := l.logger.WithFields(l.syncMapToLogFields())
+	entry.Time = time.Now()
+	entry.Level = log.Level(level)
+	entry.Message = msg
+
+	serialized, err := l.logger.Formatter.Format(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "perkakas/log: failed to format log entry: %v\n", err)
+		return
+	}
+
+	if len(l.opts.sinks) == 0 {
+		out := os.Stdout
+		if level < WarnLevel {
+			out = os.Stderr
+		}
+
+		out.Write(serialized)
+		return
+	}
+
+	for _, sink := range l.opts.sinks {
+		if lw, ok := sink.(LevelWriter); ok {
+			lw.WriteLevel(level, serialized)
+			continue
+		}
+
+		sink.Write(serialized)
+	}
+}
+
+// Close log the summary of the sampled entries, then close the sinks implementing io.Closer, flushing the buffered entries. Child loggers share the sinks,
+// so close the root logger once on shutdown.
+func (l *Logger) Close() (err error) {
+	if l.opts.sampler != nil {
+		l.opts.sampler.close()
+	}
+
+	for _, sink := range l.opts.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			if closeErr := c.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+
+	return
+}
+
+func joinMessages(msgs []message) string {
+	texts := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		texts = append(texts, fmt.Sprintf("%+v", msg.Message))
+	}
+
+	return strings.Join(texts, "; ")
+}
+
+func toFields(keysAndValues []interface{}) (fields map[string]interface{}) {
+	if len(keysAndValues) == 0 {
+		return
+	}
+
+	fields = make(map[string]interface{})
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 == len(keysAndValues) {
+			fields[key] = "(MISSING)"
+			break
+		}
+
+		value := keysAndValues[i+1]
+		if err, ok := value.(error); ok && err != nil {
+			value = err.Error()
+		}
+
+		fields[key] = value
+	}
+
+	return
+}
+
 func (l *Logger) findMaxLevel(msgs []message) (maxLevel Level) {
 	currentMaxLevel := TraceLevel
 	for _, msg := range msgs {
@@ -172,10 +373,19 @@ func (l *Logger) clear() {
 		return false
 	})
 
-	id := uuid.NewV1().String()
+	id := l.id
+	if !l.seeded {
+		id = uuid.NewV1().String()
+	}
 
 	l.fields.Store(FieldLogID, id)
+	l.fields.Store(FieldServiceName, l.service)
 	l.fields.Store("stack", []message{})
+
+	l.scoped.Range(func(key interface{}, value interface{}) bool {
+		l.fields.Store(key, value)
+		return true
+	})
 }
 
 func (l *Logger) syncMapToLogFields() (fields log.Fields) {
@@ -194,8 +404,8 @@ func (l *Logger) syncMapToLogFields() (fields log.Fields) {
 	return
 }
 
-func (l *Logger) setCaller(level Level, callerLevel int, msgs ...interface{}) {
-	if msgs == nil || len(msgs) == 0 {
+func (l *Logger) setCaller(level Level, callerLevel int, fields map[string]interface{}, msgs ...interface{}) {
+	if msgs == nil || len(msgs) == 0 || level > l.level {
 		return
 	}
 
@@ -207,9 +417,14 @@ func (l *Logger) setCaller(level Level, callerLevel int, msgs ...interface{}) {
 		if pc, file, line, ok := runtime.Caller(callerLevel); ok {
 			fName := runtime.FuncForPC(pc).Name()
 
+			var detail *errorDetail
 			err, ok := val.(error)
 			if ok && err != nil {
 				val = err.Error()
+				detail = newErrorDetail(err)
+				if detail.Code != "" {
+					l.fields.Store(FieldErrorCode, detail.Code)
+				}
 			}
 
 			vmsg := message{
@@ -218,6 +433,8 @@ func (l *Logger) setCaller(level Level, callerLevel int, msgs ...interface{}) {
 				File:     file,
 				FuncName: fName,
 				Line:     line,
+				Fields:   fields,
+				Error:    detail,
 			}
 
 			l.addMessageStack(vmsg)
@@ -254,16 +471,8 @@ func newLog(formatter log.Formatter, out io.Writer, level log.Level, reportCalle
 	return
 }
 
-func newLogger(serviceName string, logID string) (logger *Logger) {
-	formatter := &log.JSONFormatter{
-		TimestampFormat: time.RFC3339,
-		// PrettyPrint:     true,
-		FieldMap: log.FieldMap{
-			log.FieldKeyMsg: "log_message",
-		},
-	}
-
-	newLogger := newLog(formatter, os.Stdout, log.TraceLevel, false)
+func newLogger(serviceName string, logID string, opts *options) (logger *Logger) {
+	newLogger := newLog(opts.formatter(), os.Stdout, log.TraceLevel, false)
 
 	logger = new(Logger)
 	logger.logger = newLogger
@@ -281,11 +490,27 @@ func newLogger(serviceName string, logID string) (logger *Logger) {
 	logger.fields.Store(FieldLogID, id)
 	logger.fields.Store(FieldServiceName, serviceName)
 	logger.id = id
+	logger.seeded = logID != ""
 	logger.service = serviceName
+	logger.redactor = httputil.DefaultRedactor
+	logger.maxBodySize = httputil.DefaultMaxLogBodySize
+	logger.level = opts.level
+	logger.opts = opts
 	return
 }
 
-func NewLogger(serviceName string) (logger *Logger) {
-	logger = newLogger(serviceName, "")
+// NewLogger create logger for the service. By default, the entry is printed as json to stdout, or to stderr when the level
+// is error or more severe. Use the options to change the format, sinks and level.
+func NewLogger(serviceName string, opts ...Option) (logger *Logger) {
+	o := newOptions(opts...)
+	logger = newLogger(serviceName, "", o)
+
+	if o.sampling != nil {
+		o.sampler = newSampler(*o.sampling, func(level Level, msg string, repeated uint64) {
+			summary := newLogger(serviceName, "", o)
+			summary.SetField(FieldRepeated, repeated)
+			summary.write(level, fmt.Sprintf("%s (repeated %d times)", msg, repeated))
+		})
+	}
 	return
 }
@@ -1,12 +1,25 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	perrors "github.com/kitabisa/perkakas/v2/errors"
+	"github.com/kitabisa/perkakas/v2/httputil"
+	"github.com/kitabisa/perkakas/v2/structs"
+	"github.com/kitabisa/perkakas/v2/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	gock "gopkg.in/h2non/gock.v1"
@@ -100,6 +113,267 @@ func (suite *LogTestSuite) TestFindMaxLevel() {
 	assert.Equal(suite.T(), ErrorLevel, maxLevel)
 }
 
+func (suite *LogTestSuite) TestLevelAndFields() {
+	suite.Logger.SetLevel(InfoLevel)
+
+	out := captureOutput(func() {
+		suite.Logger.Debug("this is debug")
+		suite.Logger.Info("donation created", "order_id", "INV-1", "amount")
+		suite.Logger.Error(errors.New("payment failed"), "order_id", "INV-1", "cause", errors.New("timeout"))
+		suite.Logger.Print()
+	})
+
+	var entry map[string]interface{}
+	err := json.Unmarshal([]byte(out), &entry)
+	assert.Nil(suite.T(), err, out)
+
+	assert.Equal(suite.T(), "error", entry["level"])
+	assert.Equal(suite.T(), "donation created; payment failed", entry["log_message"])
+
+	stack := entry["stack"].([]interface{})
+	assert.Len(suite.T(), stack, 2, "debug message should be discarded")
+
+	fields := stack[1].(map[string]interface{})["fields"].(map[string]interface{})
+	assert.Equal(suite.T(), "INV-1", fields["order_id"])
+	assert.Equal(suite.T(), "timeout", fields["cause"])
+	assert.Equal(suite.T(), "(MISSING)", stack[0].(map[string]interface{})["fields"].(map[string]interface{})["amount"])
+
+	out = captureOutput(func() {
+		suite.Logger.Debug("only debug")
+		suite.Logger.Print()
+	})
+	assert.Empty(suite.T(), out)
+}
+
+func (suite *LogTestSuite) TestPanicLevelNotPanic() {
+	out := captureOutput(func() {
+		suite.Logger.AddMessage(PanicLevel, "This is panic")
+		suite.Logger.Print()
+	})
+
+	assert.Contains(suite.T(), out, `"level":"panic"`)
+}
+
+func TestLoggerFormatAndSinks(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("test", WithFormat(FormatLogfmt), WithSinks(buf), WithLevel(InfoLevel))
+	child := logger.NewChildLogger()
+	child.Info("donation created", "order_id", "INV-1")
+	child.Debug("discarded")
+	child.Print()
+
+	assert.Contains(t, buf.String(), "level=info")
+	assert.Contains(t, buf.String(), `log_message="donation created"`)
+	assert.Contains(t, buf.String(), "service=test")
+	assert.NotContains(t, buf.String(), "discarded")
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.log")
+	sink, err := NewFileSink(FileSinkConfig{Filename: filename, MaxSize: 10, MaxBackups: 2})
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		sink.Write([]byte("012345678\n"))
+	}
+	assert.Nil(t, sink.Close())
+
+	backups, _ := filepath.Glob(filename + ".*")
+	assert.Len(t, backups, 2, "old backups should be removed")
+
+	b, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "012345678\n", string(b))
+}
+
+type slowWriter struct {
+	mu      sync.Mutex
+	release chan struct{}
+	levels  []Level
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(TraceLevel, p)
+}
+
+func (w *slowWriter) WriteLevel(level Level, p []byte) (int, error) {
+	<-w.release
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.levels = append(w.levels, level)
+	return len(p), nil
+}
+
+func TestAsyncWriterDropPolicy(t *testing.T) {
+	sink := &slowWriter{release: make(chan struct{})}
+	async := NewAsyncWriter(sink, 1, DropNewest)
+
+	for i := 0; i < 5; i++ {
+		_, err := async.WriteLevel(ErrorLevel, []byte("entry"))
+		assert.Nil(t, err, "write should not block")
+	}
+
+	close(sink.release)
+	assert.Nil(t, async.Close())
+
+	// one entry is being written by the background goroutine, one is buffered, the others are dropped
+	assert.True(t, async.Dropped() >= 3)
+	assert.Equal(t, 5-int(async.Dropped()), len(sink.levels))
+	assert.Equal(t, ErrorLevel, sink.levels[0], "level should be passed to the sink")
+
+	_, err := async.Write([]byte("entry"))
+	assert.Equal(t, ErrWriterClosed, err)
+}
+
+func TestLoggerSampling(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("test", WithSinks(buf), WithSampling(SamplingConfig{
+		Interval:   time.Hour,
+		First:      2,
+		Thereafter: 3,
+		Rates:      map[Level]float64{DebugLevel: 0},
+	}))
+
+	for i := 0; i < 10; i++ {
+		logger.Info("campaign fetched").Print()
+		logger.Debug("debug dropped").Print()
+		logger.Error(errors.New("database is down")).Print()
+	}
+	assert.Nil(t, logger.Close())
+
+	out := buf.String()
+	assert.Equal(t, 4, strings.Count(out, `"log_message":"campaign fetched"`), "first 2, then every 3rd")
+	assert.NotContains(t, out, "debug dropped")
+	assert.Equal(t, 1, strings.Count(out, `"log_message":"database is down"`))
+	assert.Contains(t, out, `"log_message":"database is down (repeated 9 times)"`)
+	assert.Contains(t, out, `"repeated":9`)
+}
+
+func TestErrorDetail(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("test", WithSinks(buf))
+
+	err := perrors.Wrap(perrors.WithStack(structs.ErrUnauthorized), "create donation")
+	logger.Error(err).Print()
+
+	var entry struct {
+		ErrorCode string `json:"error_code"`
+		Stack     []struct {
+			Message string `json:"message"`
+			Error   struct {
+				Chain      []errorCause    `json:"chain"`
+				Code       string          `json:"code"`
+				HTTPStatus int             `json:"http_status"`
+				StackTrace []perrors.Frame `json:"stacktrace"`
+			} `json:"error"`
+		} `json:"stack"`
+	}
+
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+	assert.Equal(t, "00002", entry.ErrorCode)
+
+	msg := entry.Stack[0]
+	assert.Equal(t, "create donation: You are not authorized", msg.Message)
+	assert.Equal(t, "00002", msg.Error.Code)
+	assert.Equal(t, http.StatusUnauthorized, msg.Error.HTTPStatus)
+	assert.Len(t, msg.Error.Chain, 3)
+	assert.Equal(t, "*structs.ErrorResponse", msg.Error.Chain[2].Type)
+	assert.True(t, strings.HasSuffix(msg.Error.StackTrace[0].Func, "log.TestErrorDetail"))
+}
+
+func TestTraceFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("test", WithSinks(buf))
+
+	ctx, span := tracing.NewTracer("test").Start(context.Background(), "HTTP GET")
+	req := httptest.NewRequest(http.MethodGet, "/campaigns", nil).WithContext(ctx)
+
+	logger.SetRequest(req)
+	logger.Info("campaign fetched").Print()
+
+	assert.Contains(t, buf.String(), `"trace_id":"`+span.SpanContext().TraceID.String()+`"`)
+	assert.Contains(t, buf.String(), `"span_id":"`+span.SpanContext().SpanID.String()+`"`)
+}
+
+func TestLogIDKeptAfterPrint(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("donation", WithSinks(buf))
+
+	ctx := httputil.ContextWithRequestID(context.Background(), "request-1")
+	child := logger.NewChildLogger()
+	child.SetRequest(httptest.NewRequest(http.MethodGet, "/campaigns", nil).WithContext(ctx))
+	child.Info("first").Print()
+	child.Info("second").Print()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		t.FailNow()
+	}
+
+	for _, line := range lines {
+		var entry map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "request-1", entry[FieldLogID], "every entry should keep the request id")
+		assert.Equal(t, "donation", entry[FieldServiceName])
+	}
+}
+
+func TestSetNilRedactor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger("test", WithSinks(buf))
+	logger.SetRedactor(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+
+	assert.NotPanics(t, func() {
+		logger.SetRequest(req)
+		logger.Info("login").Print()
+	})
+	assert.NotContains(t, buf.String(), "secret")
+	assert.NotContains(t, buf.String(), "Bearer token")
+}
+
+func TestFromContextDefaultLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetDefaultLogger(NewLogger("donation", WithSinks(buf), WithLevel(InfoLevel)))
+	defer SetDefaultLogger(nil)
+
+	// without logger in the context, the configured default logger is used
+	ctx := httputil.ContextWithRequestID(context.Background(), "request-1")
+	logger := FromContext(ctx)
+	logger.Debug("discarded")
+	logger.Info("campaign fetched").Print()
+
+	assert.Contains(t, buf.String(), `"service":"donation"`)
+	assert.Contains(t, buf.String(), `"log_id":"request-1"`)
+	assert.NotContains(t, buf.String(), "discarded")
+}
+
+// captureOutput returns what is printed to stdout and stderr by f
+func captureOutput(f func()) string {
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+
+	f()
+	w.Close()
+
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
+
 func TestLogTestSuite(t *testing.T) {
 	suite.Run(t, new(LogTestSuite))
 }
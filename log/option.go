@@ -0,0 +1,106 @@
+package log
+
+import (
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Format is the output format of the log entry
+type Format int
+
+const (
+	// FormatJSON print the entry as json, one entry per line. This is the default format.
+	FormatJSON Format = iota
+
+	// FormatLogfmt print the entry as key=value pairs
+	FormatLogfmt
+
+	// FormatConsole print the entry in human readable colored text, for local development
+	FormatConsole
+)
+
+// Option configure the logger created by NewLogger
+type Option func(*options)
+
+type options struct {
+	format Format
+	sinks  []io.Writer
+	level  Level
+
+	sampling *SamplingConfig
+	sampler  *sampler
+}
+
+// WithFormat set the output format. Default is FormatJSON.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithSinks set the writers the entry is written to, e.g. file, syslog or async writer. Sink implementing LevelWriter
+// receives the severity level of the entry. By default, the entry is written to stderr when the level is error or more
+// severe, otherwise to stdout.
+func WithSinks(sinks ...io.Writer) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, sinks...)
+	}
+}
+
+// WithLevel set the minimum severity level of the message. See Logger.SetLevel.
+func WithLevel(level Level) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithSampling sample the entries to limit the log volume, e.g. during incidents. See SamplingConfig.
+func WithSampling(conf SamplingConfig) Option {
+	return func(o *options) {
+		o.sampling = &conf
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		format: FormatJSON,
+		level:  TraceLevel,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+func (o *options) formatter() log.Formatter {
+	fieldMap := log.FieldMap{
+		log.FieldKeyMsg: "log_message",
+	}
+
+	switch o.format {
+	case FormatLogfmt:
+		return &log.TextFormatter{
+			DisableColors:    true,
+			FullTimestamp:    true,
+			TimestampFormat:  time.RFC3339,
+			QuoteEmptyFields: true,
+			FieldMap:         fieldMap,
+		}
+	case FormatConsole:
+		return &log.TextFormatter{
+			ForceColors:     true,
+			FullTimestamp:   true,
+			TimestampFormat: "15:04:05.000",
+			FieldMap:        fieldMap,
+		}
+	}
+
+	return &log.JSONFormatter{
+		TimestampFormat: time.RFC3339,
+		FieldMap:        fieldMap,
+	}
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const defaultSamplingInterval = time.Second
+
+// SamplingConfig is the configuration of log sampling. The entry is keyed by its level and log message.
+type SamplingConfig struct {
+	// Interval is the sampling window. Default is 1 second.
+	Interval time.Duration
+
+	// First entries of each key are logged in every window, then every Thereafter-th entry. Zero First disables it.
+	// Error and more severe entry is not sampled by First and Thereafter, see the deduplication below.
+	First      int
+	Thereafter int
+
+	// Rates is the probability an entry of the level is logged, between 0 and 1, e.g. {InfoLevel: 0.1, DebugLevel: 0.01}.
+	// Error and more severe level is ignored.
+	Rates map[Level]float64
+}
+
+// sampler decide whether an entry is logged. Error entries are always kept but deduplicated: the first entry of each
+// key is logged, the rest are counted and logged as a summary at the end of the window.
+type sampler struct {
+	conf   SamplingConfig
+	emit   func(level Level, msg string, repeated uint64)
+	stop   chan struct{}
+	closed sync.Once
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	counts  map[string]int
+	repeats map[string]*repeatedEntry
+}
+
+type repeatedEntry struct {
+	level Level
+	msg   string
+	count uint64
+}
+
+func newSampler(conf SamplingConfig, emit func(level Level, msg string, repeated uint64)) *sampler {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultSamplingInterval
+	}
+
+	s := &sampler{
+		conf:    conf,
+		emit:    emit,
+		stop:    make(chan struct{}),
+		counts:  make(map[string]int),
+		repeats: make(map[string]*repeatedEntry),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *sampler) allow(level Level, msg string) bool {
+	key := fmt.Sprintf("%d:%s", level, msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if level <= ErrorLevel {
+		if entry, ok := s.repeats[key]; ok {
+			entry.count++
+			return false
+		}
+
+		s.repeats[key] = &repeatedEntry{level: level, msg: msg}
+		return true
+	}
+
+	if s.conf.First > 0 {
+		s.counts[key]++
+		count := s.counts[key]
+		if count > s.conf.First && (s.conf.Thereafter <= 0 || (count-s.conf.First)%s.conf.Thereafter != 0) {
+			return false
+		}
+	}
+
+	if rate, ok := s.conf.Rates[level]; ok && rand.Float64() >= rate {
+		return false
+	}
+
+	return true
+}
+
+func (s *sampler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush log the summary of the repeated error entries, then start a new window
+func (s *sampler) flush() {
+	s.mu.Lock()
+	repeats := s.repeats
+	s.counts = make(map[string]int)
+	s.repeats = make(map[string]*repeatedEntry)
+	s.mu.Unlock()
+
+	for _, entry := range repeats {
+		if entry.count > 0 {
+			s.emit(entry.level, entry.msg, entry.count)
+		}
+	}
+}
+
+// close stop the sampler and log the summary of the current window
+func (s *sampler) close() {
+	s.closed.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+	})
+}
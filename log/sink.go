@@ -0,0 +1,136 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LevelWriter is a sink receiving the severity level of the entry, e.g. to map it to syslog severity
+type LevelWriter interface {
+	WriteLevel(level Level, p []byte) (n int, err error)
+}
+
+// FileSinkConfig is the configuration of file sink
+type FileSinkConfig struct {
+	// Filename is the file the entry is written to. The rotated file is renamed to Filename.<timestamp>.
+	Filename string
+
+	// MaxSize rotate the file when the size would exceed MaxSize bytes. Zero disables size based rotation.
+	MaxSize int64
+
+	// RotateEvery rotate the file after it's opened for RotateEvery, e.g. 24 * time.Hour. Zero disables time based rotation.
+	RotateEvery time.Duration
+
+	// MaxBackups is the maximum number of rotated files kept, the oldest is removed. Zero keeps all rotated files.
+	MaxBackups int
+}
+
+// FileSink write the entry to a file, rotated by size and time. It is safe for concurrent use.
+type FileSink struct {
+	mu       sync.Mutex
+	conf     FileSinkConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewFileSink open or create the file for appending
+func NewFileSink(conf FileSinkConfig) (sink *FileSink, err error) {
+	sink = &FileSink{conf: conf}
+	if err = sink.open(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (s *FileSink) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shouldRotate(int64(len(p))) {
+		if err = s.rotate(); err != nil {
+			return
+		}
+	}
+
+	n, err = s.file.Write(p)
+	s.size += int64(n)
+	return
+}
+
+// Close close the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) shouldRotate(size int64) bool {
+	if s.conf.MaxSize > 0 && s.size > 0 && s.size+size > s.conf.MaxSize {
+		return true
+	}
+
+	return s.conf.RotateEvery > 0 && time.Since(s.openedAt) >= s.conf.RotateEvery
+}
+
+func (s *FileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.conf.Filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.conf.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := s.conf.Filename + "." + time.Now().Format("20060102-150405.000000")
+	if err := os.Rename(s.conf.Filename, rotated); err != nil {
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	s.removeOldBackups()
+	return nil
+}
+
+func (s *FileSink) removeOldBackups() {
+	if s.conf.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(s.conf.Filename + ".*")
+	if err != nil || len(backups) <= s.conf.MaxBackups {
+		return
+	}
+
+	// the timestamp suffix sorts in rotation order
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.conf.MaxBackups] {
+		os.Remove(backup)
+	}
+}
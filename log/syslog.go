@@ -0,0 +1,59 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"log/syslog"
+)
+
+// SyslogSink write the entry to syslog, with the severity mapped from the entry level
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connect to the syslog server at raddr over network, "udp" or "tcp". When network is empty,
+// it connects to the local syslog server. tag is usually the service name.
+func NewSyslogSink(network, raddr, tag string) (sink *SyslogSink, err error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return
+	}
+
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Write(p []byte) (n int, err error) {
+	return s.w.Write(p)
+}
+
+// WriteLevel write the entry with the syslog severity of level
+func (s *SyslogSink) WriteLevel(level Level, p []byte) (n int, err error) {
+	msg := string(p)
+
+	switch level {
+	case PanicLevel:
+		err = s.w.Emerg(msg)
+	case FatalLevel:
+		err = s.w.Crit(msg)
+	case ErrorLevel:
+		err = s.w.Err(msg)
+	case WarnLevel:
+		err = s.w.Warning(msg)
+	case InfoLevel:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close close the connection to syslog server
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
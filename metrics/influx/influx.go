@@ -123,7 +123,12 @@ func (c *Client) NewBatchPointsWriter(precision string) (bpw BatchPointsWriter,
 }
 
 func (b BatchPointsWriter) AddPoints(name string, tags Tags, fields Fields) {
-	pt, err := client.NewPoint(name, tags, fields, time.Now())
+	b.AddPointsWithTime(name, tags, fields, time.Now())
+}
+
+// AddPointsWithTime add point with the time it's measured, e.g. when the point is buffered before written
+func (b BatchPointsWriter) AddPointsWithTime(name string, tags Tags, fields Fields, t time.Time) {
+	pt, err := client.NewPoint(name, tags, fields, t)
 	if err != nil {
 		return
 	}
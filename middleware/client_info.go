@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+// NewClientInfo resolve the client ip, user agent, platform and client version, then store it to the request context
+// as httputil.ClientInfo, so the logger and handler can use it. X-Forwarded-For and X-Real-IP are only trusted when
+// the request comes from the proxies in trustedCIDRs. It panics when the cidr is invalid.
+func NewClientInfo(trustedCIDRs ...string) func(next http.Handler) http.Handler {
+	resolver := httputil.MustNewClientIPResolver(trustedCIDRs...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := httputil.ContextWithClientInfo(r.Context(), resolver.ClientInfo(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
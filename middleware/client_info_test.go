@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientInfoStoredInContext(t *testing.T) {
+	var info httputil.ClientInfo
+	handler := NewClientInfo("10.0.0.0/8")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, _ = httputil.ClientInfoFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(httputil.HeaderForwardedFor, "36.72.10.5")
+	req.Header.Set(httputil.HeaderPlatformName, "android")
+	req.Header.Set(httputil.HeaderClientVersion, "3.1.0")
+	req.Header.Set("User-Agent", "okhttp/4.9.0")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "36.72.10.5", info.IP)
+	assert.Equal(t, "android", info.Platform)
+	assert.Equal(t, "3.1.0", info.ClientVersion)
+	assert.Equal(t, "okhttp", info.UserAgent.Browser)
+}
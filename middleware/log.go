@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"fmt"
+	"math/rand"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/kitabisa/perkakas/v2/httputil"
 	"github.com/kitabisa/perkakas/v2/log"
 )
 
@@ -10,12 +15,78 @@ type HttpRequestLoggerMiddleware struct {
 	logger *log.Logger
 }
 
+// HttpRequestLoggerConfig is the configuration of http request logger middleware
+type HttpRequestLoggerConfig struct {
+	// MaxBodySize is the maximum response body size captured for logging. Default is httputil.DefaultMaxLogBodySize.
+	MaxBodySize int64
+
+	// SampleBody decide whether the response body of the request is captured. Default is capturing all response body.
+	// Use SampleBodyByPath to sample per route.
+	SampleBody func(r *http.Request) bool
+}
+
+// NewHttpRequestLogger create child logger of logger for each request, and store it to the request context.
+// The handler gets the logger with log.FromContext(r.Context()). The access entry with response status, size, headers,
+// body and latency is always written when the request ends, together with the messages not printed by the handler.
 func NewHttpRequestLogger(logger *log.Logger) func(next http.Handler) http.Handler {
+	return NewHttpRequestLoggerWithConfig(logger, HttpRequestLoggerConfig{})
+}
+
+// NewHttpRequestLoggerWithConfig is like NewHttpRequestLogger with configurable response body capturing
+func NewHttpRequestLoggerWithConfig(logger *log.Logger, conf HttpRequestLoggerConfig) func(next http.Handler) http.Handler {
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = httputil.DefaultMaxLogBodySize
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logger.SetRequest(r)
-			next.ServeHTTP(w, r)
-			logger.Print()
+			start := time.Now()
+
+			ctx := r.Context()
+			if httputil.RequestIDFromContext(ctx) == "" {
+				// child logger shares the parent log id, so each request needs its own id
+				ctx = httputil.ContextWithRequestID(ctx, httputil.NewRequestID())
+			}
+
+			reqLogger := logger.NewChildLogger()
+			r = r.WithContext(log.NewContext(ctx, reqLogger))
+			reqLogger.SetRequest(r)
+
+			rw := newResponseWriter(w)
+			rw.captureBody = conf.SampleBody == nil || conf.SampleBody(r)
+			rw.maxBodySize = conf.MaxBodySize
+
+			next.ServeHTTP(rw.wrap(), r)
+
+			reqLogger.SetResponse(rw, []byte(rw.Body()))
+			reqLogger.SetField(log.FieldHTTPStatus, rw.status)
+			reqLogger.SetField(log.FieldResponseSize, rw.size)
+			reqLogger.SetField(log.FieldLatency, float64(time.Since(start))/float64(time.Millisecond))
+
+			level := log.InfoLevel
+			if rw.status >= http.StatusInternalServerError {
+				level = log.ErrorLevel
+			} else if rw.status >= http.StatusBadRequest {
+				level = log.WarnLevel
+			}
+
+			reqLogger.AddMessage(level, fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, rw.status))
+			reqLogger.Print()
 		})
 	}
 }
+
+// SampleBodyByPath returns body sampler for HttpRequestLoggerConfig. rates maps the path prefix to the sampling rate
+// between 0 and 1, the longest matching prefix is used. Request not matching any prefix is sampled with defaultRate.
+func SampleBodyByPath(rates map[string]float64, defaultRate float64) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		rate, matched := defaultRate, ""
+		for prefix, prefixRate := range rates {
+			if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(matched) {
+				rate, matched = prefixRate, prefix
+			}
+		}
+
+		return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+	}
+}
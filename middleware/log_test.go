@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+	plog "github.com/kitabisa/perkakas/v2/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// logEntries decode the json entries written to buf
+func logEntries(t *testing.T, buf *bytes.Buffer) (entries []map[string]interface{}) {
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func TestHttpRequestLoggerAccessEntry(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := plog.NewLogger("donation", plog.WithSinks(buf))
+
+	// the handler logs nothing
+	handler := NewHttpRequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/campaigns", nil)
+	req = req.WithContext(httputil.ContextWithRequestID(req.Context(), "request-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logEntries(t, buf)
+	if !assert.Len(t, entries, 1) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, "GET /campaigns 500", entries[0]["log_message"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entries[0][plog.FieldHTTPStatus])
+	assert.Equal(t, "request-1", entries[0][plog.FieldLogID])
+	assert.Contains(t, entries[0], plog.FieldLatency)
+}
+
+func TestHttpRequestLoggerPrintInHandler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := plog.NewLogger("donation", plog.WithSinks(buf))
+
+	handler := NewHttpRequestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plog.FromContext(r.Context()).Info("donation created").Print()
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(`{"amount":1}`))
+	req = req.WithContext(httputil.ContextWithRequestID(req.Context(), "request-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the access entry still has the request fields after the handler prints
+	entries := logEntries(t, buf)
+	if !assert.Len(t, entries, 2) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "donation created", entries[0]["log_message"])
+	assert.Equal(t, "POST /donations 201", entries[1]["log_message"])
+	for _, entry := range entries {
+		assert.Equal(t, "request-1", entry[plog.FieldLogID])
+		assert.Equal(t, "donation", entry[plog.FieldServiceName])
+		assert.Equal(t, "/donations", entry[plog.FieldEndpoint])
+		assert.Equal(t, http.MethodPost, entry[plog.FieldMethod])
+		assert.Equal(t, `{"amount":1}`, entry[plog.FieldRequestBody])
+	}
+}
+
+func TestHttpRequestLoggerPerRequest(t *testing.T) {
+	parent := plog.NewLogger("test")
+
+	loggers := make(chan *plog.Logger, 2)
+	handler := NewHttpRequestLogger(parent)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := plog.FromContext(r.Context())
+		logger.AddMessage(plog.InfoLevel, "hello")
+		loggers <- logger
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/donations", strings.NewReader(`{"amount":1}`)))
+	}
+
+	first, second := <-loggers, <-loggers
+	assert.NotEqual(t, parent, first)
+	assert.False(t, first == second, "each request should have its own logger")
+}
+
+func TestResponseWriterRecordStatusAndSize(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newResponseWriter(rec)
+
+	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("not found"))
+
+	assert.Equal(t, http.StatusNotFound, w.status)
+	assert.Equal(t, int64(9), w.size)
+	assert.Equal(t, "not found", rec.Body.String())
+}
+
+func TestResponseWriterCaptureBody(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newResponseWriter(rec)
+	w.captureBody = true
+	w.maxBodySize = 5
+
+	w.Write([]byte("hello "))
+	w.Write([]byte("world"))
+	w.Flush()
+
+	assert.Equal(t, "hello...[truncated]", w.Body())
+	assert.Equal(t, int64(11), w.size)
+	assert.Equal(t, "hello world", rec.Body.String())
+	assert.True(t, rec.Flushed, "flush should be passed through")
+
+	_, _, err := w.Hijack()
+	assert.NotNil(t, err)
+
+	rec = httptest.NewRecorder()
+	w = newResponseWriter(rec)
+	w.captureBody = true
+	w.maxBodySize = 5
+	w.Header().Set("Content-Type", "image/png")
+	w.Write([]byte("binary content"))
+	assert.Equal(t, "[image/png body, 14 bytes]", w.Body())
+}
+
+func TestResponseWriterWrapOptionalInterfaces(t *testing.T) {
+	rec := httptest.NewRecorder()
+	wrapped := newResponseWriter(rec).wrap()
+
+	_, isFlusher := wrapped.(http.Flusher)
+	_, isHijacker := wrapped.(http.Hijacker)
+	assert.True(t, isFlusher)
+	assert.False(t, isHijacker, "recorder doesn't support hijack")
+
+	// writer without http.Flusher, e.g. wrapped by other middleware, must not look like it can stream
+	wrapped = newResponseWriter(struct{ http.ResponseWriter }{rec}).wrap()
+	_, isFlusher = wrapped.(http.Flusher)
+	assert.False(t, isFlusher)
+
+	wrapped.Write([]byte("ok"))
+	assert.Equal(t, "ok", rec.Body.String())
+}
+
+func TestSampleBodyByPath(t *testing.T) {
+	sample := SampleBodyByPath(map[string]float64{
+		"/donations":        1,
+		"/donations/upload": 0,
+	}, 0)
+
+	assert.True(t, sample(httptest.NewRequest(http.MethodPost, "/donations/123", nil)))
+	assert.False(t, sample(httptest.NewRequest(http.MethodPost, "/donations/upload", nil)))
+	assert.False(t, sample(httptest.NewRequest(http.MethodGet, "/campaigns", nil)))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// NonceStore keeps the nonce that has been used, so the same signed request can not be replayed
+type NonceStore interface {
+	// Use mark the nonce as used for ttl. It returns false when the nonce already used before.
+	Use(clientName, nonce string, ttl time.Duration) (ok bool, err error)
+}
+
+type redisNonceStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisNonceStore create nonce store backed by redis. The nonce will be stored with key prefix:client_name:nonce.
+func NewRedisNonceStore(pool *redis.Pool, prefix string) NonceStore {
+	if prefix == "" {
+		prefix = "perkakas:nonce"
+	}
+
+	return &redisNonceStore{
+		pool:   pool,
+		prefix: prefix,
+	}
+}
+
+func (s *redisNonceStore) Use(clientName, nonce string, ttl time.Duration) (ok bool, err error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	key := fmt.Sprintf("%s:%s:%s", s.prefix, clientName, nonce)
+	ttlMs := int64(ttl / time.Millisecond)
+	if ttlMs <= 0 {
+		ttlMs = 1
+	}
+
+	_, err = redis.String(conn.Do("SET", key, 1, "PX", ttlMs, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+// NewRequestID store the X-Ktbs-Request-ID header to the request context, so the logger and http client
+// can use it. When the header is empty, new request id will be generated.
+func NewRequestID() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(httputil.HeaderRequestID)
+			if requestID == "" {
+				requestID = httputil.NewRequestID()
+				r.Header.Set(httputil.HeaderRequestID, requestID)
+			}
+
+			w.Header().Set(httputil.HeaderRequestID, requestID)
+			ctx := httputil.ContextWithRequestID(r.Context(), requestID)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
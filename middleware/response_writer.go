@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/kitabisa/perkakas/v2/httputil"
+)
+
+var errHijackNotSupported = errors.New("perkakas/middleware: http.Hijacker is not supported by the response writer")
+
+// responseWriter wrap http.ResponseWriter to record the status code, the number of bytes written and a size capped
+// copy of the body. Give wrap() to the handler, so it only implements http.Flusher, http.Hijacker and http.Pusher
+// that the wrapped writer implements.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+
+	// body is only captured when captureBody is true, up to maxBodySize
+	captureBody bool
+	maxBodySize int64
+	body        bytes.Buffer
+	truncated   bool
+	binary      bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// wrap returns w implementing only the optional interfaces of the wrapped writer, so the handler asserting
+// http.Flusher, e.g. to stream server sent events, knows whether flushing works
+func (w *responseWriter) wrap() http.ResponseWriter {
+	_, isFlusher := w.ResponseWriter.(http.Flusher)
+	_, isHijacker := w.ResponseWriter.(http.Hijacker)
+	_, isPusher := w.ResponseWriter.(http.Pusher)
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, w, w, w}
+	case isFlusher && isHijacker:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, w, w}
+	case isFlusher && isPusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{w, w, w}
+	case isHijacker && isPusher:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, w, w}
+	case isFlusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+		}{w, w}
+	case isHijacker:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{w, w}
+	case isPusher:
+		return struct {
+			http.ResponseWriter
+			http.Pusher
+		}{w, w}
+	}
+
+	return struct {
+		http.ResponseWriter
+	}{w}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+		w.binary = httputil.IsBinaryContentType(w.Header().Get("Content-Type"))
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err = w.ResponseWriter.Write(b)
+	w.size += int64(n)
+
+	if w.captureBody && !w.binary && n > 0 {
+		w.capture(b[:n])
+	}
+
+	return
+}
+
+func (w *responseWriter) capture(b []byte) {
+	remaining := w.maxBodySize - int64(w.body.Len())
+	if int64(len(b)) > remaining {
+		b = b[:remaining]
+		w.truncated = true
+	}
+
+	w.body.Write(b)
+}
+
+// Body returns the captured body. Binary body is summarized, and truncated body is suffixed with "...[truncated]".
+func (w *responseWriter) Body() string {
+	if !w.captureBody {
+		return ""
+	}
+
+	if w.binary {
+		return fmt.Sprintf("[%s body, %d bytes]", w.Header().Get("Content-Type"), w.size)
+	}
+
+	if w.truncated {
+		return w.body.String() + "...[truncated]"
+	}
+
+	return w.body.String()
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackNotSupported
+	}
+
+	return h.Hijack()
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+
+	return p.Push(target, opts)
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// AnyClient is the client name used by static secret provider when the client name is not registered
+const AnyClient = "*"
+
+// ClientSecret is the secret registered for a client name
+type ClientSecret struct {
+	// Secrets is the active secrets of the client. More than one secret can be active while rotating the secret.
+	Secrets []string `json:"secrets"`
+
+	// Platforms is allowed X-Ktbs-Platform-Name of the client. Empty means all platform is allowed.
+	Platforms []string `json:"platforms"`
+}
+
+// IsPlatformAllowed check whether platform is allowed for the client
+func (c ClientSecret) IsPlatformAllowed(platform string) bool {
+	if len(c.Platforms) == 0 {
+		return true
+	}
+
+	for _, p := range c.Platforms {
+		if p == platform {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SecretProvider lookup the secret for X-Ktbs-Client-Name
+type SecretProvider interface {
+	ClientSecret(clientName string) (secret ClientSecret, ok bool)
+}
+
+type staticSecretProvider struct {
+	clients map[string]ClientSecret
+}
+
+// NewStaticSecretProvider create secret provider from map of client name. Client name "*" (AnyClient) will be used
+// when the client name is not found.
+func NewStaticSecretProvider(clients map[string]ClientSecret) SecretProvider {
+	return &staticSecretProvider{
+		clients: clients,
+	}
+}
+
+func (p *staticSecretProvider) ClientSecret(clientName string) (secret ClientSecret, ok bool) {
+	return lookupClientSecret(p.clients, clientName)
+}
+
+// FileSecretProvider load client secrets from json file, and reload it when the file is changed.
+// The file content is a json object of client name to ClientSecret, for example:
+//	{"kitabisa-apps": {"secrets": ["new-secret", "old-secret"], "platforms": ["android", "ios"]}}
+type FileSecretProvider struct {
+	path    string
+	modTime time.Time
+	clients map[string]ClientSecret
+	mutex   sync.RWMutex
+	done    chan struct{}
+	closed  sync.Once
+}
+
+// NewFileSecretProvider load the secret file and check the file for changes every interval.
+// Call Close to stop reloading the file.
+func NewFileSecretProvider(path string, interval time.Duration) (p *FileSecretProvider, err error) {
+	p = &FileSecretProvider{
+		path: path,
+		done: make(chan struct{}),
+	}
+
+	err = p.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		go p.watch(interval)
+	}
+
+	return
+}
+
+func (p *FileSecretProvider) ClientSecret(clientName string) (secret ClientSecret, ok bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return lookupClientSecret(p.clients, clientName)
+}
+
+// Reload read the secret file when it has been modified since the last load
+func (p *FileSecretProvider) Reload() (err error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return
+	}
+
+	p.mutex.RLock()
+	modified := !info.ModTime().Equal(p.modTime)
+	p.mutex.RUnlock()
+
+	if !modified {
+		return
+	}
+
+	b, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return
+	}
+
+	var clients map[string]ClientSecret
+	err = json.Unmarshal(b, &clients)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	p.clients = clients
+	p.modTime = info.ModTime()
+	p.mutex.Unlock()
+
+	return
+}
+
+// Close stop reloading the secret file. It's safe to call it more than once.
+func (p *FileSecretProvider) Close() {
+	p.closed.Do(func() {
+		close(p.done)
+	})
+}
+
+func (p *FileSecretProvider) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// keep the last loaded secrets when the file is broken
+			p.Reload()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func lookupClientSecret(clients map[string]ClientSecret, clientName string) (secret ClientSecret, ok bool) {
+	secret, ok = clients[clientName]
+	if !ok {
+		secret, ok = clients[AnyClient]
+	}
+
+	return
+}
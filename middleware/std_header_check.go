@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	phttp "github.com/kitabisa/perkakas/v2/http"
+	"github.com/kitabisa/perkakas/v2/httputil"
 	"github.com/kitabisa/perkakas/v2/signature"
 	"github.com/kitabisa/perkakas/v2/structs"
 )
 
+// DefaultClockSkew is the clock skew of signature version 2 when HeaderCheckConfig.ClockSkew is zero
+const DefaultClockSkew = 5 * time.Minute
+
+var timeNow = time.Now
+
 type Header struct {
 	XKtbsRequestID     string `valid:"uuidv4,required"`
 	XKtbsApiVersion    string `valid:"semver,required"`
@@ -18,27 +27,73 @@ type Header struct {
 	XKtbsClientName    string `valid:"required"`
 
 	// Optional
-	XKtbsSignature string `valid:"optional"`
-	XKtbsTime      string `valid:"int,optional"`
-	Authorization  string `valid:"optional"`
+	XKtbsSignature        string `valid:"optional"`
+	XKtbsSignatureVersion string `valid:"optional"`
+	XKtbsNonce            string `valid:"optional"`
+	XKtbsTime             string `valid:"int,optional"`
+	Authorization         string `valid:"optional"`
+}
+
+// HeaderCheckConfig is the configuration for header check middleware
+type HeaderCheckConfig struct {
+	// SecretKey is the key for generating HMAC signature, shared by every client.
+	// It's only used when SecretProvider is nil.
+	SecretKey string
+
+	// SecretProvider lookup the secrets and allowed platforms by X-Ktbs-Client-Name
+	SecretProvider SecretProvider
+
+	// ClockSkew is the maximum allowed difference between X-Ktbs-Time and server time.
+	// Zero means the time of legacy signature is not checked, while signature version 2 uses DefaultClockSkew,
+	// since the nonce is only kept for the time window.
+	ClockSkew time.Duration
+
+	// AllowLegacySignature accept signature of ClientName+Time when X-Ktbs-Signature-Version header is empty
+	AllowLegacySignature bool
+
+	// NonceStore is used for rejecting replayed request on signature version 2.
+	// When it's nil, the nonce is not checked.
+	NonceStore NonceStore
+
+	// MaxBodySize is the maximum request body read for verifying signature version 2. The larger request is
+	// rejected before its body is buffered. Default is httputil.DefaultMaxSignedBodySize.
+	MaxBodySize int64
 }
 
+// NewHeaderCheck check the standard header with legacy signature scheme
 func NewHeaderCheck(hctx phttp.HttpHandlerContext, secretKey string) func(next http.Handler) http.Handler {
+	return NewHeaderCheckWithConfig(hctx, HeaderCheckConfig{
+		SecretKey:            secretKey,
+		AllowLegacySignature: true,
+	})
+}
+
+// NewHeaderCheckWithConfig check the standard header, the time window, the signature and the nonce based on conf
+func NewHeaderCheckWithConfig(hctx phttp.HttpHandlerContext, conf HeaderCheckConfig) func(next http.Handler) http.Handler {
 	writer := phttp.CustomWriter{
 		C: hctx,
 	}
 
+	secretProvider := conf.SecretProvider
+	if secretProvider == nil {
+		secretProvider = NewStaticSecretProvider(map[string]ClientSecret{
+			AnyClient: {Secrets: []string{conf.SecretKey}},
+		})
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := Header{
-				XKtbsRequestID:     r.Header.Get("X-Ktbs-Request-ID"),
-				XKtbsApiVersion:    r.Header.Get("X-Ktbs-Api-Version"),
-				XKtbsClientVersion: r.Header.Get("X-Ktbs-Client-Version"),
-				XKtbsPlatformName:  r.Header.Get("X-Ktbs-Platform-Name"),
-				XKtbsClientName:    r.Header.Get("X-Ktbs-Client-Name"),
-				XKtbsSignature:     r.Header.Get("X-Ktbs-Signature"),
-				XKtbsTime:          r.Header.Get("X-Ktbs-Time"),
-				Authorization:      r.Header.Get("Authorization"),
+				XKtbsRequestID:        r.Header.Get(httputil.HeaderRequestID),
+				XKtbsApiVersion:       r.Header.Get("X-Ktbs-Api-Version"),
+				XKtbsClientVersion:    r.Header.Get("X-Ktbs-Client-Version"),
+				XKtbsPlatformName:     r.Header.Get("X-Ktbs-Platform-Name"),
+				XKtbsClientName:       r.Header.Get("X-Ktbs-Client-Name"),
+				XKtbsSignature:        r.Header.Get("X-Ktbs-Signature"),
+				XKtbsSignatureVersion: r.Header.Get("X-Ktbs-Signature-Version"),
+				XKtbsNonce:            r.Header.Get("X-Ktbs-Nonce"),
+				XKtbsTime:             r.Header.Get("X-Ktbs-Time"),
+				Authorization:         r.Header.Get("Authorization"),
 			}
 
 			_, err := govalidator.ValidateStruct(header)
@@ -47,14 +102,132 @@ func NewHeaderCheck(hctx phttp.HttpHandlerContext, secretKey string) func(next h
 				return
 			}
 
-			data := fmt.Sprintf("%s%s", header.XKtbsClientName, header.XKtbsTime)
-			match := signature.IsMatchHmac(data, header.XKtbsSignature, secretKey)
-			if !match {
+			if !isTimeInWindow(header.XKtbsTime, conf.ClockSkew) {
+				writer.WriteError(w, structs.ErrExpiredHeaderTime)
+				return
+			}
+
+			clientSecret, ok := secretProvider.ClientSecret(header.XKtbsClientName)
+			if !ok {
 				writer.WriteError(w, structs.ErrInvalidHeaderSignature)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			if !clientSecret.IsPlatformAllowed(header.XKtbsPlatformName) {
+				writer.WriteError(w, structs.ErrInvalidHeader)
+				return
+			}
+
+			switch header.XKtbsSignatureVersion {
+			case signature.Version2:
+				err = checkSignatureV2(r, header, clientSecret.Secrets, conf)
+			case "":
+				err = checkLegacySignature(header, clientSecret.Secrets, conf)
+			default:
+				err = structs.ErrInvalidHeader
+			}
+
+			if err != nil {
+				writer.WriteError(w, err)
+				return
+			}
+
+			ctx := httputil.ContextWithRequestID(r.Context(), header.XKtbsRequestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+func checkLegacySignature(header Header, secrets []string, conf HeaderCheckConfig) (err error) {
+	if !conf.AllowLegacySignature {
+		return structs.ErrInvalidHeaderSignature
+	}
+
+	data := fmt.Sprintf("%s%s", header.XKtbsClientName, header.XKtbsTime)
+	if !isMatchAnySecret(data, header.XKtbsSignature, secrets) {
+		return structs.ErrInvalidHeaderSignature
+	}
+
+	return
+}
+
+func checkSignatureV2(r *http.Request, header Header, secrets []string, conf HeaderCheckConfig) (err error) {
+	if header.XKtbsSignature == "" || header.XKtbsTime == "" || header.XKtbsNonce == "" {
+		return structs.ErrInvalidHeader
+	}
+
+	clockSkew := conf.ClockSkew
+	if clockSkew <= 0 {
+		clockSkew = DefaultClockSkew
+	}
+
+	if !isTimeInWindow(header.XKtbsTime, clockSkew) {
+		return structs.ErrExpiredHeaderTime
+	}
+
+	maxBodySize := conf.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = httputil.DefaultMaxSignedBodySize
+	}
+
+	body, err := httputil.ReadRequestBodyMax(r, maxBodySize)
+	if errors.Is(err, httputil.ErrBodyTooLarge) {
+		return structs.ErrRequestTooLarge
+	}
+
+	if err != nil {
+		return structs.ErrInvalidHeaderSignature
+	}
+
+	canonicalRequest := signature.CanonicalRequest(r.Method, r.URL.EscapedPath(), r.URL.Query(), body)
+	data := signature.StringToSign(header.XKtbsClientName, header.XKtbsTime, header.XKtbsNonce, canonicalRequest)
+
+	if !isMatchAnySecret(data, header.XKtbsSignature, secrets) {
+		return structs.ErrInvalidHeaderSignature
+	}
+
+	if conf.NonceStore == nil {
+		return
+	}
+
+	// nonce only need to be kept as long as the time window, after that the request is rejected by time check.
+	// The window is X-Ktbs-Time ± clockSkew, so the nonce used at the start of the window is kept until its end.
+	ok, err := conf.NonceStore.Use(header.XKtbsClientName, header.XKtbsNonce, 2*clockSkew)
+	if err != nil {
+		return structs.ErrUnknown
+	}
+
+	if !ok {
+		return structs.ErrReplayedRequest
+	}
+
+	return
+}
+
+func isMatchAnySecret(data, sign string, secrets []string) bool {
+	for _, secret := range secrets {
+		if signature.IsMatchHmac(data, sign, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTimeInWindow(timestamp string, clockSkew time.Duration) bool {
+	if clockSkew <= 0 {
+		return true
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	diff := timeNow().Sub(time.Unix(unix, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= clockSkew
+}
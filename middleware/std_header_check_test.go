@@ -6,12 +6,17 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	phttp "github.com/kitabisa/perkakas/v2/http"
+	"github.com/kitabisa/perkakas/v2/httputil"
 	"github.com/kitabisa/perkakas/v2/signature"
 	"github.com/kitabisa/perkakas/v2/structs"
 	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
 )
 
 var testHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -54,3 +59,256 @@ func TestStdHeaderValidation(t *testing.T) {
 
 	fmt.Printf("%s", greeting)
 }
+
+func TestRequestIDStoredInContext(t *testing.T) {
+	requestID := uuid.NewV4().String()
+
+	var ctxRequestID, headerRequestID string
+	handler := NewRequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxRequestID = httputil.RequestIDFromContext(r.Context())
+		headerRequestID = r.Header.Get(httputil.HeaderRequestID)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(httputil.HeaderRequestID, requestID)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, requestID, ctxRequestID)
+	assert.Equal(t, requestID, rec.Header().Get(httputil.HeaderRequestID))
+
+	// request id should be generated when the header is empty
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.NotEmpty(t, ctxRequestID)
+	assert.Equal(t, headerRequestID, ctxRequestID, "generated id should be set to the incoming X-Ktbs-Request-ID header")
+	assert.Equal(t, ctxRequestID, rec.Header().Get(httputil.HeaderRequestID))
+}
+
+type memoryNonceStore struct {
+	used map[string]bool
+	ttl  time.Duration
+}
+
+func (s *memoryNonceStore) Use(clientName, nonce string, ttl time.Duration) (bool, error) {
+	s.ttl = ttl
+	key := clientName + nonce
+	if s.used[key] {
+		return false, nil
+	}
+
+	s.used[key] = true
+	return true, nil
+}
+
+func newSignedRequestV2(body, timestamp, nonce string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/donations?b=2&a=1", strings.NewReader(body))
+
+	canonicalRequest := signature.CanonicalRequest(http.MethodPost, "/donations", req.URL.Query(), []byte(body))
+	sign := signature.GenerateHmac(signature.StringToSign("kitabisa-apps", timestamp, nonce, canonicalRequest), "key")
+
+	req.Header.Set("X-Ktbs-Request-ID", uuid.NewV4().String())
+	req.Header.Set("X-Ktbs-Api-Version", "1.0.1")
+	req.Header.Set("X-Ktbs-Client-Version", "1.1.1")
+	req.Header.Set("X-Ktbs-Platform-Name", "android")
+	req.Header.Set("X-Ktbs-Client-Name", "kitabisa-apps")
+	req.Header.Set("X-Ktbs-Signature", sign)
+	req.Header.Set("X-Ktbs-Signature-Version", signature.Version2)
+	req.Header.Set("X-Ktbs-Nonce", nonce)
+	req.Header.Set("X-Ktbs-Time", timestamp)
+	return req
+}
+
+func TestHeaderCheckSignatureV2(t *testing.T) {
+	now := time.Unix(1573197959, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	headerCheck := NewHeaderCheckWithConfig(hctx, HeaderCheckConfig{
+		SecretKey:  "key",
+		ClockSkew:  5 * time.Minute,
+		NonceStore: &memoryNonceStore{used: make(map[string]bool)},
+	})
+	handler := headerCheck(testHandler)
+
+	req := newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// same nonce should be rejected
+	req = newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrReplayedRequest.HttpStatus, rec.Code)
+
+	// tampered body should be rejected
+	req = newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-2")
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"amount":1}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrInvalidHeaderSignature.HttpStatus, rec.Code)
+
+	// time out of window should be rejected
+	req = newSignedRequestV2(`{"amount":10000}`, "1573190000", "nonce-3")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrExpiredHeaderTime.HttpStatus, rec.Code)
+
+	// legacy signature is not allowed
+	req = newSignedRequestV2("", "1573197959", "nonce-4")
+	req.Header.Del("X-Ktbs-Signature-Version")
+	req.Header.Set("X-Ktbs-Signature", signature.GenerateHmac("kitabisa-apps1573197959", "key"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrInvalidHeaderSignature.HttpStatus, rec.Code)
+}
+
+func TestHeaderCheckSignatureV2DefaultClockSkew(t *testing.T) {
+	now := time.Unix(1573197959, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	nonceStore := &memoryNonceStore{used: make(map[string]bool)}
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	handler := NewHeaderCheckWithConfig(hctx, HeaderCheckConfig{
+		SecretKey:  "key",
+		NonceStore: nonceStore,
+	})(testHandler)
+
+	req := newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// the nonce is kept for the whole time window
+	assert.Equal(t, 2*DefaultClockSkew, nonceStore.ttl)
+
+	// replaying the request once the nonce is expired is rejected by the time window
+	now = now.Add(2*DefaultClockSkew + time.Second)
+	req = newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrExpiredHeaderTime.HttpStatus, rec.Code)
+}
+
+func TestHeaderCheckSignatureV2MaxBodySize(t *testing.T) {
+	now := time.Unix(1573197959, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	var body string
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	headerCheck := NewHeaderCheckWithConfig(hctx, HeaderCheckConfig{
+		SecretKey:   "key",
+		MaxBodySize: 16,
+	})
+	handler := headerCheck(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	req := newSignedRequestV2(`{"amount":10000}`, "1573197959", "nonce-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"amount":10000}`, body, "handler should read the whole body")
+
+	req = newSignedRequestV2(`{"amount":100000}`, "1573197959", "nonce-2")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrRequestTooLarge.HttpStatus, rec.Code)
+
+	// body without content length, e.g. chunked, is rejected after reading the limit
+	req = newSignedRequestV2(`{"amount":100000}`, "1573197959", "nonce-3")
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, structs.ErrRequestTooLarge.HttpStatus, rec.Code)
+}
+
+func TestHeaderCheckSecretProvider(t *testing.T) {
+	hctx := phttp.NewContextHandler(structs.Meta{})
+	provider := NewStaticSecretProvider(map[string]ClientSecret{
+		"kitabisa-apps": {Secrets: []string{"new-key", "key"}, Platforms: []string{"android", "ios"}},
+	})
+	handler := NewHeaderCheckWithConfig(hctx, HeaderCheckConfig{
+		SecretProvider:       provider,
+		AllowLegacySignature: true,
+	})(testHandler)
+
+	newRequest := func(clientName, platform, secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Ktbs-Request-ID", uuid.NewV4().String())
+		req.Header.Set("X-Ktbs-Api-Version", "1.0.1")
+		req.Header.Set("X-Ktbs-Client-Version", "1.1.1")
+		req.Header.Set("X-Ktbs-Platform-Name", platform)
+		req.Header.Set("X-Ktbs-Client-Name", clientName)
+		req.Header.Set("X-Ktbs-Time", "1573197959")
+		req.Header.Set("X-Ktbs-Signature", signature.GenerateHmac(clientName+"1573197959", secret))
+		return req
+	}
+
+	cases := []struct {
+		name       string
+		req        *http.Request
+		httpStatus int
+	}{
+		{"new secret", newRequest("kitabisa-apps", "android", "new-key"), http.StatusOK},
+		{"old secret", newRequest("kitabisa-apps", "ios", "key"), http.StatusOK},
+		{"wrong secret", newRequest("kitabisa-apps", "ios", "wrong-key"), structs.ErrInvalidHeaderSignature.HttpStatus},
+		{"platform not allowed", newRequest("kitabisa-apps", "web", "key"), structs.ErrInvalidHeader.HttpStatus},
+		{"unknown client", newRequest("other-apps", "android", "key"), structs.ErrInvalidHeaderSignature.HttpStatus},
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, c.req)
+		assert.Equal(t, c.httpStatus, rec.Code, c.name)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	f, err := ioutil.TempFile("", "secrets-*.json")
+	if err != nil {
+		t.FailNow()
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"kitabisa-apps": {"secrets": ["key"], "platforms": ["android"]}}`)
+	f.Close()
+
+	provider, err := NewFileSecretProvider(f.Name(), 0)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer provider.Close()
+
+	secret, ok := provider.ClientSecret("kitabisa-apps")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"key"}, secret.Secrets)
+
+	err = ioutil.WriteFile(f.Name(), []byte(`{"kitabisa-apps": {"secrets": ["new-key", "key"]}}`), 0644)
+	if err != nil {
+		t.FailNow()
+	}
+	os.Chtimes(f.Name(), time.Now(), time.Now().Add(time.Second))
+
+	err = provider.Reload()
+	assert.Nil(t, err)
+
+	secret, ok = provider.ClientSecret("kitabisa-apps")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"new-key", "key"}, secret.Secrets)
+	assert.True(t, secret.IsPlatformAllowed("web"))
+
+	_, ok = provider.ClientSecret("other-apps")
+	assert.False(t, ok)
+
+	// closing twice must not panic
+	provider.Close()
+}
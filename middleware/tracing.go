@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kitabisa/perkakas/v2/tracing"
+)
+
+// NewTracing start a server span for each request, as the child of the W3C traceparent header when it's sent by
+// the caller. The span is stored to the request context, so the logger, http client and other traced calls
+// use it as their parent. Put it before the logger middleware, so the log has the trace id.
+func NewTracing(tracer *tracing.Tracer) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Extract(r.Context(), r.Header)
+			ctx, span := tracer.Start(ctx, "HTTP "+r.Method, tracing.WithSpanKind(tracing.SpanKindServer))
+			defer span.End()
+
+			span.SetAttribute("http.method", r.Method)
+			span.SetAttribute("http.target", r.URL.Path)
+			span.SetAttribute("http.host", r.Host)
+			span.SetAttribute("http.user_agent", r.UserAgent())
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw.wrap(), r.WithContext(ctx))
+
+			tracing.SetHTTPStatus(span, rw.status)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+)
+
+// Algorithm is the hash algorithm used for the signature
+type Algorithm int
+
+const (
+	SHA256 Algorithm = iota
+	SHA512
+)
+
+// Encoding is the text encoding of the signature
+type Encoding int
+
+const (
+	Hex Encoding = iota
+	Base64
+)
+
+func (a Algorithm) newHash() func() hash.Hash {
+	if a == SHA512 {
+		return sha512.New
+	}
+
+	return sha256.New
+}
+
+func (a Algorithm) cryptoHash() crypto.Hash {
+	if a == SHA512 {
+		return crypto.SHA512
+	}
+
+	return crypto.SHA256
+}
+
+func (a Algorithm) sum(data []byte) []byte {
+	h := a.newHash()()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (e Encoding) encode(b []byte) string {
+	if e == Base64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	if e == Base64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,142 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+var (
+	ErrInvalidPEM     = errors.New("signature: invalid PEM block")
+	ErrInvalidKeyType = errors.New("signature: invalid key type")
+)
+
+// SignEd25519 sign data with ed25519 private key
+func SignEd25519(data []byte, privateKey ed25519.PrivateKey, encoding Encoding) string {
+	return encoding.encode(ed25519.Sign(privateKey, data))
+}
+
+// VerifyEd25519 check whether signature is valid ed25519 signature of data
+func VerifyEd25519(data []byte, signature string, publicKey ed25519.PublicKey, encoding Encoding) bool {
+	sign, err := encoding.decode(signature)
+	if err != nil {
+		return false
+	}
+
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(publicKey, data, sign)
+}
+
+// SignRSAPSS sign data with RSA-PSS using the selected hash algorithm
+func SignRSAPSS(data []byte, privateKey *rsa.PrivateKey, algorithm Algorithm, encoding Encoding) (signature string, err error) {
+	sign, err := rsa.SignPSS(rand.Reader, privateKey, algorithm.cryptoHash(), algorithm.sum(data), nil)
+	if err != nil {
+		return
+	}
+
+	signature = encoding.encode(sign)
+	return
+}
+
+// VerifyRSAPSS check whether signature is valid RSA-PSS signature of data
+func VerifyRSAPSS(data []byte, signature string, publicKey *rsa.PublicKey, algorithm Algorithm, encoding Encoding) bool {
+	sign, err := encoding.decode(signature)
+	if err != nil {
+		return false
+	}
+
+	err = rsa.VerifyPSS(publicKey, algorithm.cryptoHash(), algorithm.sum(data), sign, nil)
+	return err == nil
+}
+
+// ParseEd25519PrivateKey parse PKCS8 PEM encoded ed25519 private key
+func ParseEd25519PrivateKey(pemBytes []byte) (key ed25519.PrivateKey, err error) {
+	parsed, err := parsePrivateKey(pemBytes)
+	if err != nil {
+		return
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return
+}
+
+// ParseEd25519PublicKey parse PKIX PEM encoded ed25519 public key
+func ParseEd25519PublicKey(pemBytes []byte) (key ed25519.PublicKey, err error) {
+	parsed, err := parsePublicKey(pemBytes)
+	if err != nil {
+		return
+	}
+
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return
+}
+
+// ParseRSAPrivateKey parse PKCS1 or PKCS8 PEM encoded RSA private key
+func ParseRSAPrivateKey(pemBytes []byte) (key *rsa.PrivateKey, err error) {
+	parsed, err := parsePrivateKey(pemBytes)
+	if err != nil {
+		return
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return
+}
+
+// ParseRSAPublicKey parse PKIX or PKCS1 PEM encoded RSA public key
+func ParseRSAPublicKey(pemBytes []byte) (key *rsa.PublicKey, err error) {
+	parsed, err := parsePublicKey(pemBytes)
+	if err != nil {
+		return
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return
+}
+
+func parsePrivateKey(pemBytes []byte) (key interface{}, err error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(pemBytes []byte) (key interface{}, err error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
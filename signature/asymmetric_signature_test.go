@@ -0,0 +1,61 @@
+package signature_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/kitabisa/perkakas/v2/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEd25519(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.FailNow()
+	}
+
+	data := []byte(`{"event":"donation.paid"}`)
+	sign := signature.SignEd25519(data, privateKey, signature.Base64)
+
+	assert.True(t, signature.VerifyEd25519(data, sign, publicKey, signature.Base64))
+	assert.False(t, signature.VerifyEd25519([]byte(`{"event":"donation.failed"}`), sign, publicKey, signature.Base64))
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.FailNow()
+	}
+
+	parsed, err := signature.ParseEd25519PrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, privateKey, parsed)
+}
+
+func TestRSAPSS(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.FailNow()
+	}
+
+	data := []byte(`{"event":"donation.paid"}`)
+	sign, err := signature.SignRSAPSS(data, privateKey, signature.SHA512, signature.Hex)
+	assert.Nil(t, err)
+
+	assert.True(t, signature.VerifyRSAPSS(data, sign, &privateKey.PublicKey, signature.SHA512, signature.Hex))
+	assert.False(t, signature.VerifyRSAPSS(data, sign, &privateKey.PublicKey, signature.SHA256, signature.Hex))
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.FailNow()
+	}
+
+	publicKey, err := signature.ParseRSAPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.Nil(t, err)
+	assert.Equal(t, &privateKey.PublicKey, publicKey)
+
+	_, err = signature.ParseEd25519PublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.Equal(t, signature.ErrInvalidKeyType, err)
+}
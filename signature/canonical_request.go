@@ -0,0 +1,65 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Version2 is the signature version which sign the canonical request instead of only client name and time
+const Version2 = "2"
+
+// CanonicalRequest build canonical form of the request: method, path, sorted query and hex sha256 of the body,
+// separated by new line
+func CanonicalRequest(method, path string, query url.Values, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return CanonicalRequestWithBodyHash(method, path, query, bodyHash[:])
+}
+
+// CanonicalRequestWithBodyHash build the canonical request from the sha256 of the body, e.g. hashed while streaming
+// the body instead of reading it into memory
+func CanonicalRequestWithBodyHash(method, path string, query url.Values, bodyHash []byte) string {
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(query),
+		hex.EncodeToString(bodyHash),
+	}, "\n")
+}
+
+// StringToSign build the data to be signed on signature version 2
+func StringToSign(clientName, timestamp, nonce, canonicalRequest string) string {
+	return strings.Join([]string{
+		Version2,
+		clientName,
+		timestamp,
+		nonce,
+		canonicalRequest,
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
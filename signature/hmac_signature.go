@@ -2,29 +2,50 @@ package signature
 
 import (
 	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 )
 
+// Hmac generate and verify HMAC signature with the selected algorithm & encoding
+type Hmac struct {
+	Algorithm Algorithm
+	Encoding  Encoding
+}
+
+// NewHmac create HMAC signer with the selected algorithm & encoding
+func NewHmac(algorithm Algorithm, encoding Encoding) Hmac {
+	return Hmac{
+		Algorithm: algorithm,
+		Encoding:  encoding,
+	}
+}
+
+// Generate will transform data into HMAC signature based on secret_key
+func (h Hmac) Generate(data, secretKey string) string {
+	return h.Encoding.encode(h.sum(data, secretKey))
+}
+
+// Verify will check whether signature is match with expected HMAC signature. The comparison is done in constant time.
+func (h Hmac) Verify(data, signature, secretKey string) bool {
+	sign, err := h.Encoding.decode(signature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(sign, h.sum(data, secretKey))
+}
+
+func (h Hmac) sum(data, secretKey string) []byte {
+	mac := hmac.New(h.Algorithm.newHash(), []byte(secretKey))
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
 // GenerateHmac will transform data into HMAC signature based on sha256 & secret_key
 func GenerateHmac(data, secretKey string) string {
-	h := hmac.New(sha256.New, []byte(secretKey))
-	h.Write([]byte(data))
-
-	result := h.Sum(nil)
-	return hex.EncodeToString(result)
+	return NewHmac(SHA256, Hex).Generate(data, secretKey)
 }
 
 // IsMatchHmac will check whether signature is match with expected HMAC signature
 func IsMatchHmac(data, signature, secretKey string) bool {
-	h := hmac.New(sha256.New, []byte(secretKey))
-	h.Write([]byte(data))
-
-	result := h.Sum(nil)
-	expected := hex.EncodeToString(result)
-
-	if signature == expected {
-		return true
-	}
-	return false
+	return NewHmac(SHA256, Hex).Verify(data, signature, secretKey)
 }
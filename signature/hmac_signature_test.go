@@ -1,6 +1,7 @@
 package signature_test
 
 import (
+	"net/url"
 	"testing"
 
 	"github.com/kitabisa/perkakas/v2/signature"
@@ -44,3 +45,27 @@ func TestIsMatchHmacFalse(t *testing.T) {
 	expected := false
 	assert.Equal(t, expected, result)
 }
+
+func TestCanonicalRequest(t *testing.T) {
+	query := url.Values{
+		"b": []string{"2", "1"},
+		"a": []string{"x y"},
+	}
+
+	result := signature.CanonicalRequest("post", "/donations", query, []byte(""))
+	expected := "POST\n/donations\na=x+y&b=1&b=2\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	assert.Equal(t, expected, result)
+}
+
+func TestHmacSHA512Base64(t *testing.T) {
+	message := "this is my message"
+	secretKey := "123-qwe"
+	hmac := signature.NewHmac(signature.SHA512, signature.Base64)
+
+	sign := hmac.Generate(message, secretKey)
+	assert.Len(t, sign, 88)
+	assert.True(t, hmac.Verify(message, sign, secretKey))
+	assert.False(t, hmac.Verify(message, sign, "wrong-key"))
+	assert.False(t, hmac.Verify(message, "not base64", secretKey))
+	assert.False(t, signature.IsMatchHmac(message, sign, secretKey))
+}
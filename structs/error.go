@@ -47,3 +47,47 @@ var ErrInvalidHeaderSignature *ErrorResponse = &ErrorResponse{
 	},
 	HttpStatus: http.StatusBadRequest,
 }
+
+var ErrExpiredHeaderTime *ErrorResponse = &ErrorResponse{
+	Response: Response{
+		ResponseCode: "00005",
+		ResponseDesc: ResponseDesc{
+			ID: "Waktu pada header sudah kedaluwarsa",
+			EN: "Header time is expired",
+		},
+	},
+	HttpStatus: http.StatusUnauthorized,
+}
+
+var ErrReplayedRequest *ErrorResponse = &ErrorResponse{
+	Response: Response{
+		ResponseCode: "00006",
+		ResponseDesc: ResponseDesc{
+			ID: "Request sudah pernah dikirim",
+			EN: "Request has been replayed",
+		},
+	},
+	HttpStatus: http.StatusUnauthorized,
+}
+
+var ErrServiceUnavailable *ErrorResponse = &ErrorResponse{
+	Response: Response{
+		ResponseCode: "00007",
+		ResponseDesc: ResponseDesc{
+			ID: "Layanan sedang tidak tersedia, silahkan coba beberapa saat lagi",
+			EN: "Service unavailable",
+		},
+	},
+	HttpStatus: http.StatusServiceUnavailable,
+}
+
+var ErrRequestTooLarge *ErrorResponse = &ErrorResponse{
+	Response: Response{
+		ResponseCode: "00008",
+		ResponseDesc: ResponseDesc{
+			ID: "Ukuran request terlalu besar",
+			EN: "Request is too large",
+		},
+	},
+	HttpStatus: http.StatusRequestEntityTooLarge,
+}
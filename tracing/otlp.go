@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultOTLPTimeout = 10 * time.Second
+
+// OTLPConfig is the configuration of OTLP over HTTP exporter
+type OTLPConfig struct {
+	// Endpoint is the OTLP traces endpoint, e.g. http://otel-collector:4318/v1/traces
+	Endpoint string
+
+	// Headers is sent with every export request, e.g. the api key of the tracing backend
+	Headers map[string]string
+
+	// Timeout is the timeout of each export request. Default is 10 seconds.
+	Timeout time.Duration
+}
+
+// OTLPExporter send the spans to OpenTelemetry collector or any backend accepting OTLP over HTTP, in json encoding
+type OTLPExporter struct {
+	conf   OTLPConfig
+	client *http.Client
+}
+
+// NewOTLPExporter create OTLP over HTTP exporter
+func NewOTLPExporter(conf OTLPConfig) *OTLPExporter {
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultOTLPTimeout
+	}
+
+	return &OTLPExporter{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(newOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.conf.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("perkakas/tracing: otlp export failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// the types below follow the OTLP json encoding of ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func newOTLPRequest(spans []SpanData) otlpRequest {
+	// group the spans by service, each service is a resource
+	services := make(map[string][]otlpSpan)
+	var order []string
+	for _, span := range spans {
+		if _, ok := services[span.Service]; !ok {
+			order = append(order, span.Service)
+		}
+
+		services[span.Service] = append(services[span.Service], newOTLPSpan(span))
+	}
+
+	req := otlpRequest{}
+	for _, service := range order {
+		req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{otlpAttribute("service.name", service)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/kitabisa/perkakas/v2/tracing"},
+				Spans: services[service],
+			}},
+		})
+	}
+
+	return req
+}
+
+func newOTLPSpan(span SpanData) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              otlpSpanKind(span.Kind),
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		Status: otlpStatus{
+			Code:    int(span.StatusCode),
+			Message: span.StatusMsg,
+		},
+	}
+
+	for k, v := range span.Attributes {
+		s.Attributes = append(s.Attributes, otlpAttribute(k, v))
+	}
+
+	return s
+}
+
+func otlpSpanKind(kind SpanKind) int {
+	switch kind {
+	case SpanKindServer:
+		return 2
+	case SpanKindClient:
+		return 3
+	}
+
+	return 1
+}
+
+func otlpAttribute(key string, value interface{}) otlpKeyValue {
+	var v map[string]interface{}
+	switch val := value.(type) {
+	case string:
+		v = map[string]interface{}{"stringValue": val}
+	case bool:
+		v = map[string]interface{}{"boolValue": val}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(val)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(val, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": val}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(val)}
+	}
+
+	return otlpKeyValue{Key: key, Value: v}
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize    = 512
+	defaultBatchTimeout = 5 * time.Second
+	defaultQueueSize    = 2048
+)
+
+// BatchConfig is the configuration of batch export
+type BatchConfig struct {
+	// BatchSize is the maximum number of spans exported at once. Default is 512.
+	BatchSize int
+
+	// BatchTimeout is the maximum wait before the spans are exported. Default is 5 seconds.
+	BatchTimeout time.Duration
+
+	// QueueSize is the maximum number of spans waiting to be exported. The span is dropped when the queue is full,
+	// so a slow exporter doesn't block the application. Default is 2048.
+	QueueSize int
+}
+
+type processor interface {
+	onEnd(span SpanData)
+	shutdown(ctx context.Context) error
+}
+
+type syncProcessor struct {
+	exporter Exporter
+}
+
+func (p *syncProcessor) onEnd(span SpanData) {
+	p.exporter.Export(context.Background(), []SpanData{span})
+}
+
+func (p *syncProcessor) shutdown(ctx context.Context) error {
+	return p.exporter.Shutdown(ctx)
+}
+
+type batchProcessor struct {
+	exporter Exporter
+	conf     BatchConfig
+	queue    chan SpanData
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newBatchProcessor(exporter Exporter, conf BatchConfig) *batchProcessor {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = defaultBatchSize
+	}
+
+	if conf.BatchTimeout <= 0 {
+		conf.BatchTimeout = defaultBatchTimeout
+	}
+
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = defaultQueueSize
+	}
+
+	p := &batchProcessor{
+		exporter: exporter,
+		conf:     conf,
+		queue:    make(chan SpanData, conf.QueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go p.run()
+	return p
+}
+
+func (p *batchProcessor) onEnd(span SpanData) {
+	select {
+	case <-p.stop:
+	case p.queue <- span:
+	default:
+		// the queue is full, drop the span
+	}
+}
+
+func (p *batchProcessor) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.conf.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, p.conf.BatchSize)
+	export := func() {
+		if len(batch) > 0 {
+			p.exporter.Export(context.Background(), batch)
+			batch = make([]SpanData, 0, p.conf.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) >= p.conf.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case <-p.stop:
+			// export the queued spans before stopping
+			for {
+				select {
+				case span := <-p.queue:
+					batch = append(batch, span)
+					if len(batch) >= p.conf.BatchSize {
+						export()
+					}
+				default:
+					export()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *batchProcessor) shutdown(ctx context.Context) error {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return p.exporter.Shutdown(ctx)
+}
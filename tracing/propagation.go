@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// Inject set the W3C traceparent and tracestate header from the span in ctx. Nothing is set when there is no span.
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+
+	header.Set(HeaderTraceParent, sc.TraceParent())
+
+	if sc.TraceState != "" {
+		header.Set(HeaderTraceState, sc.TraceState)
+	} else {
+		header.Del(HeaderTraceState)
+	}
+}
+
+// Extract returns a copy of ctx that carries the remote span context from the W3C traceparent and tracestate header.
+// ctx is returned as is when the traceparent header is empty or invalid.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := ParseTraceParent(header.Get(HeaderTraceParent))
+	if err != nil {
+		return ctx
+	}
+
+	// tracestate may be split into multiple headers, they are combined as one list
+	var states []string
+	for _, state := range header[http.CanonicalHeaderKey(HeaderTraceState)] {
+		if state = strings.TrimSpace(state); state != "" {
+			states = append(states, state)
+		}
+	}
+	sc.TraceState = strings.Join(states, ",")
+
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanKind describe the relationship of the span to its parent and children
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+
+	return "internal"
+}
+
+// StatusCode is the status of the operation traced by the span
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// SpanData is the snapshot of the ended span given to the exporter
+type SpanData struct {
+	Service      string                 `json:"service"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	StatusCode   StatusCode             `json:"status_code"`
+	StatusMsg    string                 `json:"status_message,omitempty"`
+}
+
+// Span trace an operation, e.g. an incoming http request or a database call. It is safe for concurrent use.
+// All methods are no-op on nil span.
+type Span struct {
+	tracer      *Tracer
+	name        string
+	kind        SpanKind
+	spanContext SpanContext
+	parentID    SpanID
+	startTime   time.Time
+
+	mu         sync.Mutex
+	endTime    time.Time
+	attributes map[string]interface{}
+	statusCode StatusCode
+	statusMsg  string
+	ended      bool
+}
+
+// SpanContext returns the span context, propagated to other services
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.spanContext
+}
+
+// SetAttribute set the attribute of the span, e.g. http.status_code
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+
+	s.attributes[key] = value
+}
+
+// SetStatus set the status of the span
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statusCode = code
+	s.statusMsg = msg
+}
+
+// RecordError set the span status to error with the error message. Nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.SetAttribute("error", true)
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End end the span, then export it when it's sampled. Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.endTime = time.Now()
+	s.mu.Unlock()
+
+	if s.spanContext.Sampled && s.tracer != nil {
+		s.tracer.export(s.data())
+	}
+}
+
+func (s *Span) data() SpanData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+
+	data := SpanData{
+		Service:    s.tracer.service,
+		Name:       s.name,
+		Kind:       s.kind,
+		TraceID:    s.spanContext.TraceID.String(),
+		SpanID:     s.spanContext.SpanID.String(),
+		StartTime:  s.startTime,
+		EndTime:    s.endTime,
+		Attributes: attributes,
+		StatusCode: s.statusCode,
+		StatusMsg:  s.statusMsg,
+	}
+
+	if s.parentID.IsValid() {
+		data.ParentSpanID = s.parentID.String()
+	}
+
+	return data
+}
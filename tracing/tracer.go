@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Tracer create spans of a service, and export the sampled spans to the exporter
+type Tracer struct {
+	service     string
+	sampleRatio float64
+	processor   processor
+}
+
+// Option configure the tracer created by NewTracer
+type Option func(*Tracer)
+
+// WithSyncer export each span synchronously when it ends, e.g. for InMemoryExporter in tests
+func WithSyncer(exporter Exporter) Option {
+	return func(t *Tracer) {
+		t.processor = &syncProcessor{exporter: exporter}
+	}
+}
+
+// WithBatcher export the spans in batch in background. This is the recommended option for production.
+func WithBatcher(exporter Exporter, conf BatchConfig) Option {
+	return func(t *Tracer) {
+		t.processor = newBatchProcessor(exporter, conf)
+	}
+}
+
+// WithSampleRatio sample the new trace with the ratio between 0 and 1. Default is 1, sampling every trace.
+// The span with a parent follows the parent sampling decision, so the trace is complete across services.
+func WithSampleRatio(ratio float64) Option {
+	return func(t *Tracer) {
+		t.sampleRatio = ratio
+	}
+}
+
+// NewTracer create tracer of the service. Without exporter, spans are created and propagated but not exported.
+func NewTracer(service string, opts ...Option) *Tracer {
+	t := &Tracer{
+		service:     service,
+		sampleRatio: 1,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// SpanOption configure the span created by Start
+type SpanOption func(*Span)
+
+// WithSpanKind set the span kind. Default is SpanKindInternal.
+func WithSpanKind(kind SpanKind) SpanOption {
+	return func(s *Span) {
+		s.kind = kind
+	}
+}
+
+// WithAttributes set the attributes of the span
+func WithAttributes(attributes map[string]interface{}) SpanOption {
+	return func(s *Span) {
+		for k, v := range attributes {
+			s.SetAttribute(k, v)
+		}
+	}
+}
+
+// Start start a span as the child of the span in ctx, or the remote span stored with ContextWithRemoteSpanContext.
+// It returns the context carrying the new span. Nil tracer is like the package level Start.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	if t == nil {
+		return Start(ctx, name, opts...)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		tracer:    t,
+		name:      name,
+		startTime: time.Now(),
+	}
+
+	parent := SpanFromContext(ctx).SpanContext()
+	if !parent.IsValid() {
+		parent = RemoteSpanContextFromContext(ctx)
+	}
+
+	if parent.IsValid() {
+		span.spanContext.TraceID = parent.TraceID
+		span.spanContext.Sampled = parent.Sampled
+		span.spanContext.TraceState = parent.TraceState
+		span.parentID = parent.SpanID
+	} else {
+		span.spanContext.TraceID = newTraceID()
+		span.spanContext.Sampled = t.sample()
+	}
+
+	span.spanContext.SpanID = newSpanID()
+
+	for _, opt := range opts {
+		opt(span)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown export the remaining spans, then shutdown the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.processor == nil {
+		return nil
+	}
+
+	return t.processor.shutdown(ctx)
+}
+
+func (t *Tracer) sample() bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+
+	return t.sampleRatio > 0 && rand.Float64() < t.sampleRatio
+}
+
+func (t *Tracer) export(span SpanData) {
+	if t.processor != nil {
+		t.processor.onEnd(span)
+	}
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer = NewTracer("")
+)
+
+// SetGlobalTracer set the tracer used by the package level Start, when there is no span in the context.
+// Nil tracer reset it to the default tracer.
+func SetGlobalTracer(t *Tracer) {
+	if t == nil {
+		t = NewTracer("")
+	}
+
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	globalTracer = t
+}
+
+// GlobalTracer returns the tracer set by SetGlobalTracer. Default tracer doesn't export the spans.
+func GlobalTracer() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+
+	return globalTracer
+}
+
+// Start start a span with the tracer of the span in ctx, or the global tracer when there is none. It's used by
+// the packages traced without their own tracer, e.g. distlock.
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	tracer := GlobalTracer()
+	if span := SpanFromContext(ctx); span != nil && span.tracer != nil {
+		tracer = span.tracer
+	}
+
+	return tracer.Start(ctx, name, opts...)
+}
+
+type spanKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx that carries the span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span stored in ctx, or nil if there is none
+func SpanFromContext(ctx context.Context) (span *Span) {
+	if ctx == nil {
+		return
+	}
+
+	span, _ = ctx.Value(spanKey{}).(*Span)
+	return
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx that carries the span context extracted from other service,
+// so the span started with ctx is its child
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+// RemoteSpanContextFromContext returns the remote span context stored in ctx
+func RemoteSpanContextFromContext(ctx context.Context) (sc SpanContext) {
+	if ctx == nil {
+		return
+	}
+
+	sc, _ = ctx.Value(remoteSpanContextKey{}).(SpanContext)
+	return
+}
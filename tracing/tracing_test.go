@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceParent(t *testing.T) {
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-xyz-00f067aa0ba902b7-01",
+	}
+
+	for _, traceParent := range invalid {
+		_, err := ParseTraceParent(traceParent)
+		assert.NotNil(t, err, traceParent)
+	}
+}
+
+func TestSpanParentAndExport(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer("donation-service", WithSyncer(exporter))
+
+	header := http.Header{}
+	header.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Add(HeaderTraceState, "congo=t61rcWkgMzE")
+	header.Add(HeaderTraceState, "rojo=00f067aa0ba902b7")
+
+	ctx := Extract(context.Background(), header)
+	ctx, parent := tracer.Start(ctx, "HTTP POST", WithSpanKind(SpanKindServer))
+
+	// package level Start uses the tracer of the span in ctx
+	childCtx, child := Start(ctx, "insert donation", WithAttributes(map[string]interface{}{"db.system": "postgresql"}))
+	child.RecordError(errors.New("duplicate key"))
+	child.End()
+	child.End()
+
+	out := http.Header{}
+	Inject(childCtx, out)
+	assert.Equal(t, child.SpanContext().TraceParent(), out.Get(HeaderTraceParent))
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", out.Get(HeaderTraceState), "tracestate should be forwarded")
+
+	parent.End()
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 2, "span should be exported once")
+
+	assert.Equal(t, "insert donation", spans[0].Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, parent.SpanContext().SpanID.String(), spans[0].ParentSpanID)
+	assert.Equal(t, StatusError, spans[0].StatusCode)
+	assert.Equal(t, "postgresql", spans[0].Attributes["db.system"])
+
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].ParentSpanID, "server span should be the child of the remote span")
+	assert.Equal(t, SpanKindServer, spans[1].Kind)
+	assert.Equal(t, "donation-service", spans[1].Service)
+}
+
+func TestSampling(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer("test", WithSyncer(exporter), WithSampleRatio(0))
+
+	ctx, span := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	span.End()
+
+	assert.Empty(t, exporter.Spans())
+	assert.True(t, span.SpanContext().IsValid(), "unsampled span should still be propagated")
+
+	// the sampled remote parent is followed
+	ctx = ContextWithRemoteSpanContext(context.Background(), SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true})
+	_, span = tracer.Start(ctx, "server")
+	span.End()
+	assert.Len(t, exporter.Spans(), 1)
+}
+
+func TestNilTracer(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	SetGlobalTracer(NewTracer("global", WithSyncer(exporter)))
+	SetGlobalTracer(nil)
+	defer SetGlobalTracer(nil)
+
+	assert.NotNil(t, GlobalTracer())
+
+	var tracer *Tracer
+	_, span := tracer.Start(context.Background(), "nil tracer")
+	span.End()
+
+	assert.True(t, span.SpanContext().IsValid())
+	assert.Empty(t, exporter.Spans(), "global tracer should be reset to the default tracer")
+}
+
+func TestOTLPExporterWithBatcher(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+
+		var body map[string]interface{}
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		requests <- body
+	}))
+	defer ts.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: ts.URL + "/v1/traces",
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	})
+	tracer := NewTracer("donation-service", WithBatcher(exporter, BatchConfig{BatchTimeout: time.Hour}))
+
+	ctx, span := tracer.Start(context.Background(), "HTTP GET", WithSpanKind(SpanKindClient))
+	span.SetAttribute("http.status_code", 200)
+	span.End()
+
+	_, span = tracer.Start(ctx, "child")
+	span.End()
+
+	assert.Nil(t, tracer.Shutdown(context.Background()))
+
+	body := <-requests
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resource := resourceSpans["resource"].(map[string]interface{})
+	assert.Equal(t, "service.name", resource["attributes"].([]interface{})[0].(map[string]interface{})["key"])
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	assert.Len(t, spans, 2, "spans should be exported in one batch on shutdown")
+
+	first := spans[0].(map[string]interface{})
+	assert.Equal(t, "HTTP GET", first["name"])
+	assert.Equal(t, float64(3), first["kind"])
+	assert.Equal(t, map[string]interface{}{"intValue": "200"}, first["attributes"].([]interface{})[0].(map[string]interface{})["value"])
+}
+
+func TestTransport(t *testing.T) {
+	var traceParent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(HeaderTraceParent)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer("test", WithSyncer(exporter))
+	client := &http.Client{Transport: &Transport{Tracer: tracer}}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, SpanKindClient, spans[0].Kind)
+	assert.Equal(t, StatusError, spans[0].StatusCode)
+	assert.Equal(t, "00-"+spans[0].TraceID+"-"+spans[0].SpanID+"-01", traceParent)
+	assert.Empty(t, req.Header.Get(HeaderTraceParent), "request should not be modified")
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Transport trace every request with a client span, and propagate the span with W3C traceparent header.
+// The span is the child of the span in the request context.
+type Transport struct {
+	// Base is the wrapped transport. Default is http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Tracer create the span. Nil tracer uses the tracer of the span in the request context or the global tracer.
+	Tracer *Tracer
+
+	// SpanName returns the span name of the request. Default is "HTTP <method>".
+	SpanName func(req *http.Request) string
+
+	// Attributes is added to every span, e.g. {"db.system": "elasticsearch"}
+	Attributes map[string]interface{}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := "HTTP " + req.Method
+	if t.SpanName != nil {
+		name = t.SpanName(req)
+	}
+
+	ctx, span := t.Tracer.Start(req.Context(), name, WithSpanKind(SpanKindClient), WithAttributes(t.Attributes))
+	defer span.End()
+
+	SetHTTPClientAttributes(span, req)
+
+	// RoundTrip must not modify the request
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return resp, err
+	}
+
+	SetHTTPStatus(span, resp.StatusCode)
+	return resp, nil
+}
+
+// SetHTTPClientAttributes set the attributes of outbound http request to the span
+func SetHTTPClientAttributes(span *Span, req *http.Request) {
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+	span.SetAttribute("net.peer.name", req.URL.Hostname())
+}
+
+// SetHTTPStatus set the http.status_code attribute, and set the span status to error on 5xx status code
+func SetHTTPStatus(span *Span, status int) {
+	span.SetAttribute("http.status_code", status)
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, http.StatusText(status))
+	}
+}